@@ -0,0 +1,443 @@
+package virtualbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	reVirtualSystem = regexp.MustCompile(`^Virtual system (\d+):`)
+	reApplianceItem = regexp.MustCompile(`^\s*(\d+): (.*)$`)
+	reItemOption    = regexp.MustCompile(`--(\w+)`)
+	reQuoted        = regexp.MustCompile(`"([^"]*)"`)
+	reItemNumber    = regexp.MustCompile(`: (\d+)`)
+	reController    = regexp.MustCompile(`^(\w+) controller, type (\w+)`)
+	reHardDisk      = regexp.MustCompile(`target path=(.*), controller=(\d+);channel=(\d+)`)
+	reNetworkType   = regexp.MustCompile(`type=(\w+)`)
+)
+
+// ApplianceItemType identifies what an appliance item configures.
+type ApplianceItemType string
+
+const (
+	ItemOSType       = ApplianceItemType("ostype")
+	ItemName         = ApplianceItemType("vmname")
+	ItemGroup        = ApplianceItemType("group")
+	ItemSettingsFile = ApplianceItemType("settingsfile")
+	ItemBaseFolder   = ApplianceItemType("basefolder")
+	ItemDescription  = ApplianceItemType("description")
+	ItemCPUs         = ApplianceItemType("cpus")
+	ItemMemory       = ApplianceItemType("memory")
+	ItemSoundCard    = ApplianceItemType("soundcard")
+	ItemUSB          = ApplianceItemType("usb")
+	ItemNIC          = ApplianceItemType("nic")
+	ItemCDROM        = ApplianceItemType("cdrom")
+	ItemFloppy       = ApplianceItemType("floppy")
+	ItemController   = ApplianceItemType("controller")
+	ItemHardDisk     = ApplianceItemType("disk")
+	ItemOther        = ApplianceItemType("other")
+)
+
+// itemPrefixes maps the descriptions VBoxManage prints to item types. Items
+// overridden on the command line are printed as e.g. "VM name specified with
+// --vmname" instead of "Suggested VM name".
+var itemPrefixes = []struct {
+	prefix string
+	typ    ApplianceItemType
+}{
+	{"Suggested OS type", ItemOSType},
+	{"OS type specified", ItemOSType},
+	{"Suggested VM name", ItemName},
+	{"VM name specified", ItemName},
+	{"Suggested VM group", ItemGroup},
+	{"VM group specified", ItemGroup},
+	{"Suggested VM settings file name", ItemSettingsFile},
+	{"VM settings file name specified", ItemSettingsFile},
+	{"Suggested VM base folder", ItemBaseFolder},
+	{"VM base folder specified", ItemBaseFolder},
+	{"Description", ItemDescription},
+	{"Number of CPUs", ItemCPUs},
+	{"No. of CPUs specified", ItemCPUs},
+	{"Guest memory", ItemMemory},
+	{"Sound card", ItemSoundCard},
+	{"USB controller", ItemUSB},
+	{"Network adapter", ItemNIC},
+	{"CD-ROM", ItemCDROM},
+	{"Floppy", ItemFloppy},
+	{"Hard disk image", ItemHardDisk},
+}
+
+// nicTypes maps the network types of appliance NICs to NIC networks.
+var nicTypes = map[string]NICNetwork{
+	"NAT":      NICNetNAT,
+	"Bridged":  NICNetBridged,
+	"HostOnly": NICNetHostonly,
+	"Internal": NICNetInternal,
+	"Generic":  NICNetGeneric,
+}
+
+// Appliance describes the virtual systems of an OVF/OVA appliance as
+// VBoxManage would import them.
+type Appliance struct {
+	Path    string
+	Systems []ApplianceSystem
+	// Machines holds the imported machines. It is empty for a dry run.
+	Machines []*Machine
+}
+
+// ApplianceSystem is a virtual system of an appliance.
+type ApplianceSystem struct {
+	Index int
+	Items []ApplianceItem
+}
+
+// ApplianceItem is a single configuration item of a virtual system, with the
+// value VBoxManage suggests for it.
+type ApplianceItem struct {
+	Unit    int
+	Type    ApplianceItemType
+	Text    string   // description as printed by VBoxManage
+	Value   string   // suggested value, e.g. the OS type or memory in MB
+	Options []string // VBoxManage options that change the item, e.g. "ostype", "ignore"
+
+	Controller     *StorageController // set for ItemController
+	Disk           *StorageMedium     // set for ItemHardDisk
+	DiskController int                // unit of the controller a hard disk is attached to
+	NIC            *NIC               // set for ItemNIC
+}
+
+// Item returns the first item of the given type, or nil.
+func (s *ApplianceSystem) Item(typ ApplianceItemType) *ApplianceItem {
+	for i := range s.Items {
+		if s.Items[i].Type == typ {
+			return &s.Items[i]
+		}
+	}
+	return nil
+}
+
+// Name returns the suggested machine name of the system.
+func (s *ApplianceSystem) Name() string {
+	if it := s.Item(ItemName); it != nil {
+		return it.Value
+	}
+	return ""
+}
+
+// ImportSystem overrides the suggestions for one virtual system of an
+// appliance. Zero values keep the suggestion.
+type ImportSystem struct {
+	Name         string
+	OSType       string
+	Group        string
+	SettingsFile string
+	BaseFolder   string
+	Description  string
+	CPUs         uint
+	Memory       uint           // in MB
+	Ignore       []int          // units not to import
+	Disks        map[int]string // target paths of hard disks, keyed by unit
+	AcceptEULA   bool
+}
+
+// ImportOptions configures ImportAppliance.
+type ImportOptions struct {
+	DryRun      bool // only report what would be imported
+	MACPolicy   MACPolicy
+	ImportToVDI bool                 // convert the disks to VDI
+	Systems     map[int]ImportSystem // keyed by virtual system index
+}
+
+// args returns the import options.
+func (o ImportOptions) args() []string {
+	var args []string
+	if o.DryRun {
+		args = append(args, "--dry-run")
+	}
+	var options []string
+	if o.MACPolicy != MACNew {
+		options = append(options, string(o.MACPolicy))
+	}
+	if o.ImportToVDI {
+		options = append(options, "importtovdi")
+	}
+	if len(options) > 0 {
+		args = append(args, "--options", strings.Join(options, ","))
+	}
+
+	vsys := make([]int, 0, len(o.Systems))
+	for i := range o.Systems {
+		vsys = append(vsys, i)
+	}
+	sort.Ints(vsys)
+	for _, i := range vsys {
+		s := o.Systems[i]
+		n := strconv.Itoa(i)
+		args = append(args, "--vsys", n)
+		for _, opt := range []struct{ name, val string }{
+			{"--vmname", s.Name},
+			{"--ostype", s.OSType},
+			{"--group", s.Group},
+			{"--settingsfile", s.SettingsFile},
+			{"--basefolder", s.BaseFolder},
+			{"--description", s.Description},
+		} {
+			if opt.val != "" {
+				args = append(args, opt.name, opt.val)
+			}
+		}
+		if s.CPUs > 0 {
+			args = append(args, "--cpus", fmt.Sprintf("%d", s.CPUs))
+		}
+		if s.Memory > 0 {
+			args = append(args, "--memory", fmt.Sprintf("%d", s.Memory))
+		}
+		if s.AcceptEULA {
+			args = append(args, "--eula", "accept")
+		}
+		units := make([]int, 0, len(s.Disks))
+		for u := range s.Disks {
+			units = append(units, u)
+		}
+		sort.Ints(units)
+		for _, u := range units {
+			args = append(args, "--unit", strconv.Itoa(u), "--disk", s.Disks[u])
+		}
+		for _, u := range s.Ignore {
+			args = append(args, "--unit", strconv.Itoa(u), "--ignore")
+		}
+	}
+	return args
+}
+
+// ImportAppliance imports the OVF or OVA appliance at path. With
+// opts.DryRun, nothing is imported and the returned Appliance only lists the
+// suggested settings, so they can be inspected and overridden in a second
+// call.
+func ImportAppliance(ctx context.Context, path string, opts ImportOptions) (*Appliance, error) {
+	return DefaultClient.ImportAppliance(ctx, path, opts)
+}
+
+// ImportAppliance imports the OVF or OVA appliance at path. With
+// opts.DryRun, nothing is imported and the returned Appliance only lists the
+// suggested settings, so they can be inspected and overridden in a second
+// call.
+func (c *Client) ImportAppliance(ctx context.Context, path string, opts ImportOptions) (*Appliance, error) {
+	args := append([]string{"import", path}, opts.args()...)
+	out, err := c.vbmOut(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	a, err := parseAppliance(out)
+	if err != nil {
+		return nil, err
+	}
+	a.Path = path
+	if opts.DryRun {
+		return a, nil
+	}
+	for _, s := range a.Systems {
+		name := opts.Systems[s.Index].Name
+		if name == "" {
+			name = s.Name()
+		}
+		m, err := c.getMachine(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		mi := Machine(m)
+		a.Machines = append(a.Machines, &mi)
+	}
+	return a, nil
+}
+
+// parseAppliance parses the virtual systems listed by `VBoxManage import`.
+func parseAppliance(out string) (*Appliance, error) {
+	a := &Appliance{}
+	var sys *ApplianceSystem
+	var item *ApplianceItem
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		if res := reVirtualSystem.FindStringSubmatch(line); res != nil {
+			i, _ := strconv.Atoi(res[1])
+			a.Systems = append(a.Systems, ApplianceSystem{Index: i})
+			sys = &a.Systems[len(a.Systems)-1]
+			item = nil
+			continue
+		}
+		if sys == nil {
+			continue
+		}
+		if res := reApplianceItem.FindStringSubmatch(line); res != nil {
+			unit, _ := strconv.Atoi(res[1])
+			sys.Items = append(sys.Items, parseApplianceItem(unit, res[2]))
+			item = &sys.Items[len(sys.Items)-1]
+			continue
+		}
+		if item != nil && strings.HasPrefix(line, " ") {
+			// Hints such as `(change with "--vsys 0 --ostype <type>")`.
+			for _, opt := range reItemOption.FindAllStringSubmatch(line, -1) {
+				switch opt[1] {
+				case "vsys", "unit":
+				default:
+					item.Options = append(item.Options, opt[1])
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseApplianceItem interprets the description of an appliance item.
+func parseApplianceItem(unit int, text string) ApplianceItem {
+	it := ApplianceItem{Unit: unit, Type: ItemOther, Text: text}
+	for _, p := range itemPrefixes {
+		if strings.HasPrefix(text, p.prefix) {
+			it.Type = p.typ
+			break
+		}
+	}
+	switch it.Type {
+	case ItemOSType, ItemName, ItemGroup, ItemSettingsFile, ItemBaseFolder, ItemDescription:
+		if res := reQuoted.FindStringSubmatch(text); res != nil {
+			it.Value = res[1]
+		}
+	case ItemCPUs, ItemMemory:
+		if res := reItemNumber.FindStringSubmatch(text); res != nil {
+			it.Value = res[1]
+		}
+	case ItemNIC:
+		nic := &NIC{}
+		if res := reNetworkType.FindStringSubmatch(text); res != nil {
+			nic.Network = nicTypes[res[1]]
+			it.Value = res[1]
+		}
+		it.NIC = nic
+	case ItemHardDisk:
+		if res := reHardDisk.FindStringSubmatch(text); res != nil {
+			port, _ := strconv.ParseUint(res[3], 10, 32)
+			it.DiskController, _ = strconv.Atoi(res[2])
+			it.Value = res[1]
+			it.Disk = &StorageMedium{Port: uint(port), DriveType: DriveHDD, Medium: res[1]}
+		}
+	case ItemOther:
+		if res := reController.FindStringSubmatch(text); res != nil {
+			it.Type = ItemController
+			it.Value = res[2]
+			chipset := parseChipset(res[2])
+			if strings.EqualFold(res[2], "AHCI") {
+				chipset = CtrlIntelAHCI
+			}
+			bus := SystemBus(strings.ToLower(res[1]))
+			if b, ok := chipsetBus[chipset]; ok {
+				bus = b
+			}
+			it.Controller = &StorageController{SysBus: bus, Chipset: chipset}
+		}
+	}
+	return it
+}
+
+// OVFFormat is the OVF version an appliance is exported as.
+type OVFFormat string
+
+const (
+	OVF09 = OVFFormat("ovf09")
+	OVF10 = OVFFormat("ovf10")
+	OVF20 = OVFFormat("ovf20")
+)
+
+// ExportMACs controls which MAC addresses are written to an appliance.
+type ExportMACs string
+
+const (
+	ExportAllMACs = ExportMACs("")             // keep all MAC addresses
+	ExportNoMACs  = ExportMACs("nomacs")       // strip all MAC addresses
+	ExportNATMACs = ExportMACs("nomacsbutnat") // keep only those of NAT NICs
+)
+
+// ExportOptions configures ExportMachine.
+type ExportOptions struct {
+	Format   OVFFormat // Empty means the VBoxManage default (1.0).
+	Manifest bool      // Write a manifest with checksums.
+	ISO      bool      // Include attached ISO images.
+	MACs     ExportMACs
+
+	// Product metadata of the virtual system.
+	Name        string // Name of the exported system. Empty means the machine's name.
+	Product     string
+	ProductURL  string
+	Vendor      string
+	VendorURL   string
+	Version     string
+	Description string
+	EULA        string
+}
+
+// args returns the export options.
+func (o ExportOptions) args() []string {
+	var args []string
+	if o.Format != "" {
+		args = append(args, "--"+string(o.Format))
+	}
+	var options []string
+	if o.Manifest {
+		options = append(options, "manifest")
+	}
+	if o.ISO {
+		options = append(options, "iso")
+	}
+	if o.MACs != ExportAllMACs {
+		options = append(options, string(o.MACs))
+	}
+	if len(options) > 0 {
+		args = append(args, "--options", strings.Join(options, ","))
+	}
+	var vsys []string
+	for _, opt := range []struct{ name, val string }{
+		{"--vmname", o.Name},
+		{"--product", o.Product},
+		{"--producturl", o.ProductURL},
+		{"--vendor", o.Vendor},
+		{"--vendorurl", o.VendorURL},
+		{"--version", o.Version},
+		{"--description", o.Description},
+		{"--eula", o.EULA},
+	} {
+		if opt.val != "" {
+			vsys = append(vsys, opt.name, opt.val)
+		}
+	}
+	if len(vsys) > 0 {
+		args = append(append(args, "--vsys", "0"), vsys...)
+	}
+	return args
+}
+
+// ExportMachine exports the machine with the given name or UUID to output,
+// which must end in .ovf or .ova.
+func ExportMachine(ctx context.Context, id, output string, opts ExportOptions) error {
+	return DefaultClient.ExportMachine(ctx, id, output, opts)
+}
+
+// ExportMachine exports the machine with the given name or UUID to output,
+// which must end in .ovf or .ova.
+func (c *Client) ExportMachine(ctx context.Context, id, output string, opts ExportOptions) error {
+	switch ext := strings.ToLower(filepath.Ext(output)); ext {
+	case ".ovf", ".ova":
+	default:
+		return fmt.Errorf("export %s: unsupported appliance file extension %q", id, ext)
+	}
+	args := append([]string{"export", id, "--output", output}, opts.args()...)
+	return c.vbm(ctx, args...)
+}
@@ -0,0 +1,109 @@
+package virtualbox
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportApplianceDryRun(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["import builder.ova --dry-run"] = readFixture(t, "import-n.txt")
+	a, err := f.client().ImportAppliance(context.Background(), "builder.ova", ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Systems) != 1 || len(a.Systems[0].Items) != 16 {
+		t.Fatalf("got %+v", a.Systems)
+	}
+	if len(a.Machines) != 0 {
+		t.Errorf("dry run loaded %d machines", len(a.Machines))
+	}
+	s := a.Systems[0]
+	if got := s.Name(); got != "builder" {
+		t.Errorf("name: got %q", got)
+	}
+	for typ, want := range map[ApplianceItemType]string{
+		ItemOSType:       "Ubuntu_64",
+		ItemSettingsFile: "/home/ci/VirtualBox VMs/builder/builder.vbox",
+		ItemCPUs:         "2",
+		ItemMemory:       "2048",
+		ItemNIC:          "NAT",
+	} {
+		if it := s.Item(typ); it == nil || it.Value != want {
+			t.Errorf("%s: got %+v, want %q", typ, it, want)
+		}
+	}
+	if it := s.Item(ItemOSType); !reflect.DeepEqual(it.Options, []string{"ostype"}) {
+		t.Errorf("ostype options: got %q", it.Options)
+	}
+	if it := s.Item(ItemNIC); it.NIC == nil || it.NIC.Network != NICNetNAT {
+		t.Errorf("nic: got %+v", it.NIC)
+	}
+	ctl := s.Items[14]
+	if ctl.Type != ItemController || ctl.Controller == nil || *ctl.Controller != (StorageController{SysBus: SysBusSATA, Chipset: CtrlIntelAHCI}) {
+		t.Errorf("controller: got %+v", ctl)
+	}
+	disk := s.Item(ItemHardDisk)
+	if disk == nil || disk.Disk == nil || disk.DiskController != 14 ||
+		disk.Value != "/home/ci/VirtualBox VMs/builder/builder-disk001.vmdk" {
+		t.Fatalf("disk: got %+v", disk)
+	}
+	if want := []string{"disk", "controller", "port", "ignore"}; !reflect.DeepEqual(disk.Options, want) {
+		t.Errorf("disk options: got %q, want %q", disk.Options, want)
+	}
+}
+
+func TestImportApplianceOverrides(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo ci --machinereadable"] = strings.Replace(readFixture(t, "showvminfo.txt"), `name="builder"`, `name="ci"`, 1)
+	f.stdout["import builder.ova --options keepnatmacs --vsys 0 --vmname ci --memory 4096 --unit 15 --disk /vms/ci.vmdk --unit 9 --ignore"] =
+		readFixture(t, "import.txt")
+	a, err := f.client().ImportAppliance(context.Background(), "builder.ova", ImportOptions{
+		MACPolicy: MACKeepNAT,
+		Systems: map[int]ImportSystem{0: {
+			Name:   "ci",
+			Memory: 4096,
+			Ignore: []int{9},
+			Disks:  map[int]string{15: "/vms/ci.vmdk"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Machines) != 1 || (*a.Machines[0]).Name() != "ci" {
+		t.Errorf("got machines %v", a.Machines)
+	}
+	s := a.Systems[0]
+	if got := s.Name(); got != "ci" {
+		t.Errorf("name: got %q", got)
+	}
+	if it := s.Item(ItemMemory); it == nil || it.Value != "4096" {
+		t.Errorf("memory: got %+v", it)
+	}
+}
+
+func TestExportMachine(t *testing.T) {
+	f := newFakeVBM()
+	ctx := context.Background()
+	err := f.client().ExportMachine(ctx, "builder", "out/builder.ova", ExportOptions{
+		Format:   OVF20,
+		Manifest: true,
+		MACs:     ExportNATMACs,
+		Product:  "Build Box",
+		Version:  "1.2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"export", "builder", "--output", "out/builder.ova", "--ovf20",
+		"--options", "manifest,nomacsbutnat", "--vsys", "0", "--product", "Build Box", "--version", "1.2"}
+	if !reflect.DeepEqual(f.calls[0], want) {
+		t.Errorf("got %q, want %q", f.calls[0], want)
+	}
+
+	if err := f.client().ExportMachine(ctx, "builder", "builder.zip", ExportOptions{}); err == nil {
+		t.Error("expected an error for an unsupported extension")
+	}
+}
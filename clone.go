@@ -0,0 +1,132 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLinkedCloneNeedsSnapshot = errors.New("linked clone requires a snapshot")
+	ErrCloneNotRegistered       = errors.New("clone is not registered")
+)
+
+// CloneMode selects which part of the snapshot tree is cloned.
+type CloneMode string
+
+const (
+	CloneModeMachine            = CloneMode("machine")            // current state only
+	CloneModeMachineAndChildren = CloneMode("machineandchildren") // the snapshot and its descendants
+	CloneModeAll                = CloneMode("all")                // all snapshots
+)
+
+// MACPolicy controls the MAC addresses of the clone's NICs.
+type MACPolicy string
+
+const (
+	MACNew     = MACPolicy("")            // generate new MAC addresses
+	MACKeepAll = MACPolicy("keepallmacs") // keep all MAC addresses
+	MACKeepNAT = MACPolicy("keepnatmacs") // keep the MAC addresses of NAT NICs
+)
+
+// CloneOptions configures CloneMachine.
+type CloneOptions struct {
+	Name          string // Name of the clone. Empty means "<source> Clone".
+	UUID          string // UUID of the clone. Empty means a random one.
+	Snapshot      string // Name or UUID of the snapshot to clone. Empty means the current state.
+	Linked        bool   // Create differencing images on top of the source's; requires Snapshot.
+	Mode          CloneMode
+	MACPolicy     MACPolicy
+	KeepDiskNames bool
+	KeepHWUUIDs   bool
+	BaseFolder    string // Folder the clone is created in. Empty means default.
+	Groups        []string
+	Register      bool // Register the clone with VirtualBox.
+}
+
+// CloneMachine clones the machine with the given name or UUID and returns the
+// clone. If opts.Register is false, VirtualBox does not know about the clone,
+// so CloneMachine returns a nil Machine and ErrCloneNotRegistered once the
+// clone is created; its settings file is then in a folder named after it, in
+// opts.BaseFolder or the default machine folder.
+func CloneMachine(ctx context.Context, source string, opts CloneOptions) (*Machine, error) {
+	return DefaultClient.CloneMachine(ctx, source, opts)
+}
+
+// CloneMachine clones the machine with the given name or UUID and returns the
+// clone. If opts.Register is false, VirtualBox does not know about the clone,
+// so CloneMachine returns a nil Machine and ErrCloneNotRegistered once the
+// clone is created; its settings file is then in a folder named after it, in
+// opts.BaseFolder or the default machine folder.
+func (c *Client) CloneMachine(ctx context.Context, source string, opts CloneOptions) (*Machine, error) {
+	if opts.Linked && opts.Snapshot == "" {
+		return nil, ErrLinkedCloneNeedsSnapshot
+	}
+	args := append([]string{"clonevm", source}, opts.args()...)
+	if err := c.vbm(ctx, args...); err != nil {
+		return nil, err
+	}
+	if !opts.Register {
+		return nil, ErrCloneNotRegistered // unregistered clones cannot be looked up
+	}
+	id := opts.UUID
+	if id == "" {
+		id = opts.Name
+	}
+	if id == "" {
+		src, err := c.getMachine(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		id = src.name + " Clone"
+	}
+	m, err := c.getMachine(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	mi := Machine(m)
+	return &mi, nil
+}
+
+// args returns the clonevm options.
+func (o CloneOptions) args() []string {
+	var args []string
+	if o.Snapshot != "" {
+		args = append(args, "--snapshot", o.Snapshot)
+	}
+	if o.Mode != "" {
+		args = append(args, "--mode", string(o.Mode))
+	}
+	var options []string
+	if o.Linked {
+		options = append(options, "link")
+	}
+	if o.MACPolicy != MACNew {
+		options = append(options, string(o.MACPolicy))
+	}
+	if o.KeepDiskNames {
+		options = append(options, "keepdisknames")
+	}
+	if o.KeepHWUUIDs {
+		options = append(options, "keephwuuids")
+	}
+	if len(options) > 0 {
+		args = append(args, "--options", strings.Join(options, ","))
+	}
+	if o.Name != "" {
+		args = append(args, "--name", o.Name)
+	}
+	if len(o.Groups) > 0 {
+		args = append(args, "--groups", strings.Join(o.Groups, ","))
+	}
+	if o.BaseFolder != "" {
+		args = append(args, "--basefolder", o.BaseFolder)
+	}
+	if o.UUID != "" {
+		args = append(args, "--uuid", o.UUID)
+	}
+	if o.Register {
+		args = append(args, "--register")
+	}
+	return args
+}
@@ -0,0 +1,45 @@
+package virtualbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCloneMachine(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo ci-1 --machinereadable"] = readFixture(t, "showvminfo.txt")
+	ctx := context.Background()
+	m, err := f.client().CloneMachine(ctx, "builder", CloneOptions{
+		Name:      "ci-1",
+		Snapshot:  "clean install",
+		Linked:    true,
+		MACPolicy: MACKeepNAT,
+		Register:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"clonevm", "builder", "--snapshot", "clean install",
+		"--options", "link,keepnatmacs", "--name", "ci-1", "--register"}
+	if !reflect.DeepEqual(f.calls[0], want) {
+		t.Errorf("got %q, want %q", f.calls[0], want)
+	}
+	if m == nil || (*m).UUID() == "" {
+		t.Errorf("clone was not loaded")
+	}
+
+	f = newFakeVBM()
+	m, err = f.client().CloneMachine(ctx, "builder", CloneOptions{Name: "ci-2", BaseFolder: "/srv/vms"})
+	if err != ErrCloneNotRegistered || m != nil {
+		t.Errorf("unregistered clone: got %v, %v, want nil, %v", m, err, ErrCloneNotRegistered)
+	}
+	want = []string{"clonevm", "builder", "--name", "ci-2", "--basefolder", "/srv/vms"}
+	if len(f.calls) != 1 || !reflect.DeepEqual(f.calls[0], want) {
+		t.Errorf("got %q, want [%q]", f.calls, want)
+	}
+
+	if _, err := f.client().CloneMachine(ctx, "builder", CloneOptions{Linked: true}); err != ErrLinkedCloneNeedsSnapshot {
+		t.Errorf("got %v, want %v", err, ErrLinkedCloneNeedsSnapshot)
+	}
+}
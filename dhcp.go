@@ -2,6 +2,7 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"strings"
 )
@@ -15,7 +16,7 @@ type DHCP struct {
 	Enabled     bool
 }
 
-func addDHCP(kind, name string, d DHCP) error {
+func (c *Client) addDHCP(ctx context.Context, kind, name string, d DHCP) error {
 	args := []string{"dhcpserver", "add",
 		kind, name,
 		"--ip", d.IPv4.IP.String(),
@@ -28,22 +29,37 @@ func addDHCP(kind, name string, d DHCP) error {
 	} else {
 		args = append(args, "--disable")
 	}
-	return vbm(args...)
+	return c.vbm(ctx, args...)
 }
 
 // AddInternalDHCP adds a DHCP server to an internal network.
-func AddInternalDHCP(netname string, d DHCP) error {
-	return addDHCP("--netname", netname, d)
+func AddInternalDHCP(ctx context.Context, netname string, d DHCP) error {
+	return DefaultClient.AddInternalDHCP(ctx, netname, d)
+}
+
+// AddInternalDHCP adds a DHCP server to an internal network.
+func (c *Client) AddInternalDHCP(ctx context.Context, netname string, d DHCP) error {
+	return c.addDHCP(ctx, "--netname", netname, d)
 }
 
 // AddHostonlyDHCP adds a DHCP server to a host-only network.
-func AddHostonlyDHCP(ifname string, d DHCP) error {
-	return addDHCP("--ifname", ifname, d)
+func AddHostonlyDHCP(ctx context.Context, ifname string, d DHCP) error {
+	return DefaultClient.AddHostonlyDHCP(ctx, ifname, d)
+}
+
+// AddHostonlyDHCP adds a DHCP server to a host-only network.
+func (c *Client) AddHostonlyDHCP(ctx context.Context, ifname string, d DHCP) error {
+	return c.addDHCP(ctx, "--ifname", ifname, d)
+}
+
+// DHCPs gets all DHCP server settings in a map keyed by DHCP.NetworkName.
+func DHCPs(ctx context.Context) (map[string]*DHCP, error) {
+	return DefaultClient.DHCPs(ctx)
 }
 
 // DHCPs gets all DHCP server settings in a map keyed by DHCP.NetworkName.
-func DHCPs() (map[string]*DHCP, error) {
-	out, err := vbmOut("list", "dhcpservers")
+func (c *Client) DHCPs(ctx context.Context) (map[string]*DHCP, error) {
+	out, err := c.vbmOut(ctx, "list", "dhcpservers")
 	if err != nil {
 		return nil, err
 	}
@@ -1,52 +1,251 @@
 package virtualbox
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 )
 
 // MakeDiskImage makes a disk image at dest with the given size in MB. If r is
 // not nil, it will be read as a raw disk image to convert from.
-func MakeDiskImage(dest string, size uint, r io.Reader) error {
-	// Convert a raw image from stdin to the dest VMDK image.
-	sizeBytes := int64(size) << 20 // usually won't fit in 32-bit int (max 2GB)
-	cmd := exec.Command(VBM, "convertfromraw", "stdin", dest,
-		fmt.Sprintf("%d", sizeBytes), "--format", "VMDK")
+func MakeDiskImage(ctx context.Context, dest string, size uint, r io.Reader) error {
+	return DefaultClient.MakeDiskImage(ctx, dest, size, r)
+}
+
+// MakeDiskImage makes a disk image at dest with the given size in MB. If r is
+// not nil, it will be read as a raw disk image to convert from.
+func (c *Client) MakeDiskImage(ctx context.Context, dest string, size uint, r io.Reader) error {
+	// usually won't fit in 32-bit int (max 2GB)
+	return c.MakeDiskImageWithOptions(ctx, dest, r, DiskImageOptions{Size: int64(size) << 20})
+}
+
+// DiskImageOptions configures MakeDiskImageWithOptions.
+type DiskImageOptions struct {
+	Format   MediumFormat    // VDI, VMDK or VHD; defaults to VMDK
+	Variant  []MediumVariant // e.g. VariantFixed or VariantSplit2G; defaults to VariantStandard
+	Size     int64           // size of the disk in bytes
+	Progress func(written, total int64)
+}
 
-	if Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+// MakeDiskImageWithOptions makes a disk image at dest. If r is not nil, it
+// is read as a raw disk image to convert from, and decompressed first if it
+// is gzip, xz or zstd compressed; xz and zstd need those commands where the
+// client's Executor runs VBoxManage. Input beyond opts.Size is ignored, and
+// shorter input leaves the rest of the image empty. Progress, if set, is
+// called as the raw image is streamed to VBoxManage. If r is nil, an empty
+// image is created without streaming anything.
+func MakeDiskImageWithOptions(ctx context.Context, dest string, r io.Reader, opts DiskImageOptions) error {
+	return DefaultClient.MakeDiskImageWithOptions(ctx, dest, r, opts)
+}
+
+// MakeDiskImageWithOptions makes a disk image at dest. If r is not nil, it
+// is read as a raw disk image to convert from, and decompressed first if it
+// is gzip, xz or zstd compressed; xz and zstd need those commands where the
+// client's Executor runs VBoxManage. Input beyond opts.Size is ignored, and
+// shorter input leaves the rest of the image empty. Progress, if set, is
+// called as the raw image is streamed to VBoxManage. If r is nil, an empty
+// image is created without streaming anything.
+func (c *Client) MakeDiskImageWithOptions(ctx context.Context, dest string, r io.Reader, opts DiskImageOptions) error {
+	if opts.Size <= 0 {
+		return fmt.Errorf("make disk image %s: invalid size %d", dest, opts.Size)
+	}
+	format := opts.Format
+	if format == "" {
+		format = FormatVMDK
+	}
+	if r == nil {
+		return c.createDiskImage(ctx, dest, format, opts)
 	}
 
-	stdin, err := cmd.StdinPipe()
+	// Stop the decompressor if VBoxManage fails before reading all input.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r, wait, err := c.decompress(ctx, r)
 	if err != nil {
 		return err
 	}
-	if err := cmd.Start(); err != nil {
-		return err
+	// Convert a raw image from stdin to the dest image.
+	cmd := c.command("convertfromraw", "stdin", dest,
+		fmt.Sprintf("%d", opts.Size), "--format", string(format))
+	if len(opts.Variant) > 0 {
+		cmd.Args = append(cmd.Args, "--variant", joinVariants(opts.Variant))
+	}
+	cmd.Stdout = c.tee(nil)
+	cmd.Stderr = c.tee(nil)
+	// VBoxManage stops reading at the end of the input and leaves the rest of
+	// the image sparse, but VBoxManage.exe on Windows fails unless the
+	// number of bytes written to stdin matches the size, so fill the
+	// remainder with zeros there.
+	var stdin io.Reader = io.LimitReader(r, opts.Size)
+	if c.windowsVBM() {
+		stdin = &zeroPadReader{r: stdin, size: opts.Size}
 	}
+	if opts.Progress != nil {
+		stdin = &progressReader{r: stdin, total: opts.Size, progress: opts.Progress}
+	}
+	cmd.Stdin = stdin
+	err = c.run(ctx, cmd)
+	if err != nil {
+		cancel()
+	}
+	// A failing decompressor also fails VBoxManage, but is the real cause.
+	if werr := wait(); werr != nil && (err == nil || !errors.Is(werr, context.Canceled)) {
+		err = werr
+	}
+	if err == nil && opts.Progress != nil {
+		opts.Progress(opts.Size, opts.Size) // short input is not padded
+	}
+	return err
+}
 
-	n, err := io.Copy(stdin, r)
+// windowsVBM reports whether the client runs the Windows VBoxManage.exe,
+// either on Windows or from WSL.
+func (c *Client) windowsVBM() bool {
+	return runtime.GOOS == "windows" || strings.EqualFold(filepath.Ext(c.path()), ".exe")
+}
+
+// createDiskImage creates an empty image with createmedium, and removes it
+// from the media registry again so it is left unregistered like the images
+// made by convertfromraw.
+func (c *Client) createDiskImage(ctx context.Context, dest string, format MediumFormat, opts DiskImageOptions) error {
+	args := []string{"createmedium", "disk", "--filename", dest,
+		"--sizebyte", fmt.Sprintf("%d", opts.Size), "--format", string(format)}
+	if len(opts.Variant) > 0 {
+		args = append(args, "--variant", joinVariants(opts.Variant))
+	}
+	out, err := c.vbmOut(ctx, args...)
 	if err != nil {
 		return err
 	}
+	res := reMediumCreated.FindStringSubmatch(out)
+	if res == nil {
+		return ErrMediumCreation
+	}
+	if err := c.vbm(ctx, "closemedium", "disk", res[1]); err != nil {
+		return err
+	}
+	if opts.Progress != nil {
+		opts.Progress(opts.Size, opts.Size)
+	}
+	return nil
+}
 
-	// The total number of bytes written to stdin must match sizeBytes, or
-	// VBoxManage.exe on Windows will fail. Fill remaining with zeros.
-	if left := sizeBytes - n; left > 0 {
-		if err := ZeroFill(stdin, left); err != nil {
-			return err
+// Magic numbers of the compression formats decompress recognizes.
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicXz   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompress returns a reader of the decompressed contents of r if r is
+// gzip, xz or zstd compressed, or of r itself otherwise. xz and zstd are
+// decompressed by the xz and zstd commands, run by the client's Executor. The
+// returned function waits for the decompressor and must be called once the
+// reader is no longer used.
+func (c *Client) decompress(ctx context.Context, r io.Reader) (io.Reader, func() error, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(magicXz))
+	nop := func() error { return nil }
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip input: %w", err)
 		}
+		return zr, zr.Close, nil
+	case bytes.HasPrefix(head, magicXz):
+		return c.decompressCmd(ctx, br, "xz")
+	case bytes.HasPrefix(head, magicZstd):
+		return c.decompressCmd(ctx, br, "zstd")
 	}
+	return br, nop, nil
+}
 
-	// cmd won't exit until the stdin is closed.
-	if err := stdin.Close(); err != nil {
-		return err
+// decompressCmd pipes r through `<name> -dc`. If the decompressor fails, the
+// returned reader fails with its error instead of ending early, so a
+// truncated image is not mistaken for a complete one.
+func (c *Client) decompressCmd(ctx context.Context, r io.Reader, name string) (io.Reader, func() error, error) {
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	cmd := &Command{Path: name, Args: []string{"-dc"}, Stdin: r, Stdout: pw, Stderr: &stderr}
+	done := make(chan error, 1)
+	go func() {
+		err := c.executor().Exec(ctx, cmd)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			err = ctx.Err() // stopped, not failed
+		case err != nil:
+			err = fmt.Errorf("%s input: %v: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		pw.CloseWithError(err) // nil closes with io.EOF
+		done <- err
+	}()
+	wait := func() error {
+		// Drain the pipe so the decompressor is not blocked on a full pipe
+		// if the image was not read to its end. This returns as soon as the
+		// decompressor exits, whether it succeeded or not.
+		io.Copy(io.Discard, pr)
+		return <-done
+	}
+	return pr, wait, nil
+}
+
+// progressReader reports the number of bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	n, total int64
+	progress func(written, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.progress(p.n, p.total)
 	}
+	return n, err
+}
+
+// zeroPadReader reads r to its end and then yields zero bytes until at least
+// size bytes have been read in total.
+type zeroPadReader struct {
+	r    io.Reader
+	size int64
+	n    int64
+	eof  bool
+}
 
-	return cmd.Wait()
+func (z *zeroPadReader) Read(p []byte) (int, error) {
+	if !z.eof {
+		k, err := z.r.Read(p)
+		z.n += int64(k)
+		if err == io.EOF {
+			z.eof = true
+			err = nil
+		}
+		if k > 0 || err != nil {
+			return k, err
+		}
+	}
+	left := z.size - z.n
+	if left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	z.n += int64(len(p))
+	return len(p), nil
 }
 
 // ZeroFill writes n zero bytes into w.
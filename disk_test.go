@@ -0,0 +1,141 @@
+package virtualbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMakeDiskImagePadsInput(t *testing.T) {
+	f := newFakeVBM()
+	c := &Client{VBM: `C:\Program Files\Oracle\VirtualBox\VBoxManage.exe`, Executor: f}
+	if err := c.MakeDiskImage(context.Background(), "disk.vmdk", 1, strings.NewReader("boot")); err != nil {
+		t.Fatal(err)
+	}
+	got := f.stdin["convertfromraw stdin disk.vmdk 1048576 --format VMDK"]
+	if len(got) != 1<<20 {
+		t.Fatalf("got %d bytes on stdin, want %d", len(got), 1<<20)
+	}
+	if !bytes.HasPrefix(got, []byte("boot")) || bytes.Count(got, []byte{0}) != 1<<20-4 {
+		t.Fatal("stdin is not the input followed by zeros")
+	}
+}
+
+func TestMakeDiskImageDoesNotPadInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("input is always padded on Windows")
+	}
+	f := newFakeVBM()
+	if err := f.client().MakeDiskImage(context.Background(), "disk.vmdk", 1, strings.NewReader("boot")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.stdin["convertfromraw stdin disk.vmdk 1048576 --format VMDK"]); got != "boot" {
+		t.Errorf("got %d bytes on stdin, want the input only", len(got))
+	}
+}
+
+func TestMakeDiskImageWithOptions(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("boot sector"))
+	zw.Close()
+
+	f := newFakeVBM()
+	var last, total int64
+	err := f.client().MakeDiskImageWithOptions(context.Background(), "disk.vdi", &gz, DiskImageOptions{
+		Format:   FormatVDI,
+		Variant:  []MediumVariant{VariantFixed},
+		Size:     3000,
+		Progress: func(written, n int64) { last, total = written, n },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := f.stdin["convertfromraw stdin disk.vdi 3000 --format VDI --variant Fixed"]
+	if !bytes.HasPrefix(got, []byte("boot sector")) {
+		t.Fatalf("got %q on stdin, not the decompressed input", got)
+	}
+	if last != 3000 || total != 3000 {
+		t.Errorf("progress: got %d/%d", last, total)
+	}
+}
+
+func TestMakeDiskImageTruncatesInput(t *testing.T) {
+	f := newFakeVBM()
+	err := f.client().MakeDiskImageWithOptions(context.Background(), "disk.vmdk", strings.NewReader("0123456789"), DiskImageOptions{Size: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.stdin["convertfromraw stdin disk.vmdk 4 --format VMDK"]); got != "0123" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// fakeXz is an Executor that fakes the xz command and hands all other
+// commands to vbm.
+func fakeXz(vbm *fakeVBM, xz func(cmd *Command) error) Executor {
+	return ExecFunc(func(ctx context.Context, cmd *Command) error {
+		if cmd.Path == "xz" {
+			return xz(cmd)
+		}
+		return vbm.Exec(ctx, cmd)
+	})
+}
+
+func TestMakeDiskImageXz(t *testing.T) {
+	input := append(append([]byte{}, magicXz...), "compressed"...)
+	f := newFakeVBM()
+	c := &Client{Executor: fakeXz(f, func(cmd *Command) error {
+		if got, _ := io.ReadAll(cmd.Stdin); !bytes.Equal(got, input) || strings.Join(cmd.Args, " ") != "-dc" {
+			return fmt.Errorf("xz %q got %q", cmd.Args, got)
+		}
+		_, err := io.WriteString(cmd.Stdout, "boot sector")
+		return err
+	})}
+	err := c.MakeDiskImageWithOptions(context.Background(), "disk.vmdk", bytes.NewReader(input), DiskImageOptions{Size: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.stdin["convertfromraw stdin disk.vmdk 512 --format VMDK"]; !bytes.HasPrefix(got, []byte("boot sector")) {
+		t.Errorf("got %d bytes on stdin, not the decompressed input", len(got))
+	}
+}
+
+func TestMakeDiskImageXzFails(t *testing.T) {
+	f := newFakeVBM()
+	c := &Client{
+		VBM: "VBoxManage.exe", // pads the input, which must stop at the error
+		Executor: fakeXz(f, func(cmd *Command) error {
+			io.WriteString(cmd.Stdout, "boot")
+			io.WriteString(cmd.Stderr, "xz: (stdin): Compressed data is corrupt\n")
+			return errors.New("exit status 1")
+		}),
+	}
+	input := append(append([]byte{}, magicXz...), "corrupt"...)
+	err := c.MakeDiskImageWithOptions(context.Background(), "disk.vmdk", bytes.NewReader(input), DiskImageOptions{Size: 1 << 30})
+	if err == nil || !strings.Contains(err.Error(), "Compressed data is corrupt") {
+		t.Fatalf("got %v, want the xz error", err)
+	}
+	if got := f.stdin["convertfromraw stdin disk.vmdk 1073741824 --format VMDK"]; len(got) != 0 {
+		t.Errorf("VBoxManage read %d bytes of a failed image", len(got))
+	}
+}
+
+func TestMakeEmptyDiskImage(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["createmedium disk --filename disk.vhd --sizebyte 1073741824 --format VHD"] =
+		"Medium created. UUID: 2b1b4c5e-7d0a-4a8e-9f55-0c6b8e3f1a01\n"
+	err := f.client().MakeDiskImageWithOptions(context.Background(), "disk.vhd", nil, DiskImageOptions{Format: FormatVHD, Size: 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 2 || f.calls[1][0] != "closemedium" || f.calls[1][2] != "2b1b4c5e-7d0a-4a8e-9f55-0c6b8e3f1a01" {
+		t.Errorf("got calls %q", f.calls)
+	}
+}
@@ -0,0 +1,319 @@
+package virtualbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/markmarine/go-virtualbox/vdi"
+	"github.com/markmarine/go-virtualbox/vmdk"
+)
+
+var (
+	reDescriptorKV = regexp.MustCompile(`^([\w.]+)\s*=\s*"?([^"]*)"?\s*$`)
+	reExtent       = regexp.MustCompile(`^(RW|RDONLY|NOACCESS)\s+(\d+)\s+(\w+)(?:\s+"([^"]*)"(?:\s+(\d+))?)?`)
+)
+
+// maxDescriptorSize bounds the size of standalone VMDK descriptor files.
+const maxDescriptorSize = 1 << 20
+
+// VMDKInfo is the descriptor of a VMDK image.
+type VMDKInfo struct {
+	Path               string
+	Version            int
+	CID                uint32 // content ID, changed on every write
+	ParentCID          uint32 // CID of the parent, 0xffffffff for base images
+	CreateType         string // e.g. monolithicSparse, streamOptimized, monolithicFlat
+	ParentFileNameHint string
+	Extents            []VMDKExtent
+	Geometry           DiskGeometry
+	AdapterType        string
+	DDB                map[string]string // disk database entries, e.g. ddb.uuid.image
+}
+
+// VMDKExtent is an extent line of a VMDK descriptor.
+type VMDKExtent struct {
+	Access  string // RW, RDONLY or NOACCESS
+	Sectors uint64
+	Type    string // e.g. SPARSE, FLAT, ZERO
+	File    string
+	Offset  uint64 // in sectors, for FLAT extents
+}
+
+// DiskGeometry is the legacy CHS geometry of a disk.
+type DiskGeometry struct {
+	Cylinders uint32
+	Heads     uint32
+	Sectors   uint32
+}
+
+// Capacity returns the size of the disk in bytes.
+func (info *VMDKInfo) Capacity() int64 {
+	var n uint64
+	for _, e := range info.Extents {
+		n += e.Sectors
+	}
+	return int64(n) * vmdk.SectorSize
+}
+
+// IsBase reports whether the image has no parent.
+func (info *VMDKInfo) IsBase() bool {
+	return info.ParentCID == 0xffffffff
+}
+
+// ParentPath returns the path of the parent image from the parent file name
+// hint, relative to the image itself, or "" for base images.
+func (info *VMDKInfo) ParentPath() string {
+	hint := info.ParentFileNameHint
+	if info.IsBase() || hint == "" {
+		return ""
+	}
+	if filepath.IsAbs(hint) {
+		return hint
+	}
+	return filepath.Join(filepath.Dir(info.Path), hint)
+}
+
+// InspectVMDK reads the descriptor of the VMDK image at path, which is either
+// a sparse image with an embedded descriptor or a descriptor file.
+func InspectVMDK(path string) (*VMDKInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var desc string
+	r, err := vmdk.NewReader(f, fi.Size())
+	switch {
+	case err == nil:
+		desc = r.Descriptor()
+	case errors.Is(err, vmdk.ErrNotVMDK):
+		b, err := io.ReadAll(io.LimitReader(f, maxDescriptorSize))
+		if err != nil {
+			return nil, err
+		}
+		desc = string(b)
+	default:
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	info, err := ParseVMDKDescriptor(desc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	info.Path = path
+	return info, nil
+}
+
+// ParseVMDKDescriptor parses the text of a VMDK descriptor.
+func ParseVMDKDescriptor(desc string) (*VMDKInfo, error) {
+	info := &VMDKInfo{DDB: map[string]string{}}
+	s := bufio.NewScanner(strings.NewReader(desc))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if res := reExtent.FindStringSubmatch(line); res != nil {
+			e := VMDKExtent{Access: res[1], Type: res[3], File: res[4]}
+			e.Sectors, _ = strconv.ParseUint(res[2], 10, 64)
+			e.Offset, _ = strconv.ParseUint(res[5], 10, 64)
+			info.Extents = append(info.Extents, e)
+			continue
+		}
+		res := reDescriptorKV.FindStringSubmatch(line)
+		if res == nil {
+			continue
+		}
+		key, val := res[1], res[2]
+		switch key {
+		case "version":
+			info.Version, _ = strconv.Atoi(val)
+		case "CID", "parentCID":
+			n, err := strconv.ParseUint(val, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("vmdk descriptor: %s: %v", key, err)
+			}
+			if key == "CID" {
+				info.CID = uint32(n)
+			} else {
+				info.ParentCID = uint32(n)
+			}
+		case "createType":
+			info.CreateType = val
+		case "parentFileNameHint":
+			info.ParentFileNameHint = val
+		default:
+			if !strings.HasPrefix(key, "ddb.") {
+				continue
+			}
+			info.DDB[key] = val
+			n, _ := strconv.ParseUint(val, 10, 32)
+			switch key {
+			case "ddb.geometry.cylinders":
+				info.Geometry.Cylinders = uint32(n)
+			case "ddb.geometry.heads":
+				info.Geometry.Heads = uint32(n)
+			case "ddb.geometry.sectors":
+				info.Geometry.Sectors = uint32(n)
+			case "ddb.adapterType":
+				info.AdapterType = val
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if info.CreateType == "" {
+		return nil, errors.New("vmdk descriptor: no createType")
+	}
+	return info, nil
+}
+
+// VDIInfo is the header of a VDI image.
+type VDIInfo struct {
+	Path             string
+	Version          string // e.g. "1.1"
+	Type             string // dynamic, fixed, undo or diff
+	Description      string
+	UUID             string
+	ModifyUUID       string // changed on every write
+	ParentUUID       string // empty for base images
+	ParentModifyUUID string // ModifyUUID of the parent when the image was created
+	DiskSize         int64  // in bytes
+	BlockSize        uint32
+	Blocks           uint32
+	Allocated        uint32
+	Geometry         DiskGeometry
+	// BlockMap holds for every block of the disk its index in the image, or
+	// 0xffffffff if it is not allocated and 0xfffffffe if it is zero.
+	BlockMap []uint32
+}
+
+// vdiTypes names the VDI image types.
+var vdiTypes = map[uint32]string{
+	vdi.TypeDynamic: "dynamic",
+	vdi.TypeFixed:   "fixed",
+	vdi.TypeUndo:    "undo",
+	vdi.TypeDiff:    "diff",
+}
+
+// IsBase reports whether the image has no parent.
+func (info *VDIInfo) IsBase() bool {
+	return info.ParentUUID == ""
+}
+
+// InspectVDI reads the header and block map of the VDI image at path.
+func InspectVDI(path string) (*VDIInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := vdi.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	h := r.Header
+	info := &VDIInfo{
+		Path:        path,
+		Version:     fmt.Sprintf("%d.%d", h.Version>>16, h.Version&0xffff),
+		Type:        vdiTypes[h.Type],
+		Description: strings.TrimRight(string(h.Description[:]), "\x00"),
+		UUID:        h.UUID.String(),
+		ModifyUUID:  h.ModifyUUID.String(),
+		DiskSize:    int64(h.DiskSize),
+		BlockSize:   h.BlockSize,
+		Blocks:      h.Blocks,
+		Allocated:   h.Allocated,
+		Geometry:    DiskGeometry{h.LCHS.Cylinders, h.LCHS.Heads, h.LCHS.Sectors},
+		BlockMap:    r.Blocks(),
+	}
+	if info.Type == "" {
+		info.Type = strconv.FormatUint(uint64(h.Type), 10)
+	}
+	if !h.ParentUUID.IsZero() {
+		info.ParentUUID = h.ParentUUID.String()
+		info.ParentModifyUUID = h.ParentModifyUUID.String()
+	}
+	return info, nil
+}
+
+// ChainError reports an inconsistent link in a chain of differencing images.
+type ChainError struct {
+	Child, Parent string // paths
+	Reason        string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("disk chain %s -> %s: %s", e.Child, e.Parent, e.Reason)
+}
+
+// CheckDiskChain checks that the VMDK or VDI images at paths, from the base
+// image to the newest differencing image, form a consistent chain: every
+// image references the one before it, the first is a base image and all
+// have the same size.
+func CheckDiskChain(paths ...string) error {
+	type link struct {
+		path      string
+		base      bool
+		size      int64
+		id, mod   string // identity, and modification stamp for VDI
+		parent    string // parent identity
+		parentMod string
+	}
+	links := make([]link, len(paths))
+	for i, path := range paths {
+		l := link{path: path}
+		if strings.EqualFold(filepath.Ext(path), ".vdi") {
+			info, err := InspectVDI(path)
+			if err != nil {
+				return err
+			}
+			l.base, l.size = info.IsBase(), info.DiskSize
+			l.id, l.mod = info.UUID, info.ModifyUUID
+			l.parent, l.parentMod = info.ParentUUID, info.ParentModifyUUID
+		} else {
+			info, err := InspectVMDK(path)
+			if err != nil {
+				return err
+			}
+			l.base, l.size = info.IsBase(), info.Capacity()
+			l.id = fmt.Sprintf("%08x", info.CID)
+			l.parent = fmt.Sprintf("%08x", info.ParentCID)
+		}
+		links[i] = l
+	}
+
+	for i, l := range links {
+		if i == 0 {
+			if !l.base {
+				return &ChainError{Child: l.path, Reason: "first image is not a base image"}
+			}
+			continue
+		}
+		p := links[i-1]
+		switch {
+		case l.base:
+			return &ChainError{Child: l.path, Parent: p.path, Reason: "child is a base image"}
+		case l.parent != p.id:
+			return &ChainError{Child: l.path, Parent: p.path,
+				Reason: fmt.Sprintf("child references parent %s, parent is %s", l.parent, p.id)}
+		case l.parentMod != "" && p.mod != "" && l.parentMod != p.mod:
+			return &ChainError{Child: l.path, Parent: p.path, Reason: "parent was modified after the child was created"}
+		case l.size != p.size:
+			return &ChainError{Child: l.path, Parent: p.path,
+				Reason: fmt.Sprintf("size %d differs from parent size %d", l.size, p.size)}
+		}
+	}
+	return nil
+}
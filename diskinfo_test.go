@@ -0,0 +1,148 @@
+package virtualbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/markmarine/go-virtualbox/vdi"
+	"github.com/markmarine/go-virtualbox/vmdk"
+)
+
+func TestInspectVMDKDescriptor(t *testing.T) {
+	info, err := InspectVMDK("testdata/diff-descriptor.vmdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CID != 0x3c1a6f2e || info.ParentCID != 0x9b54e0d1 || info.IsBase() {
+		t.Errorf("got CID %08x, parent CID %08x", info.CID, info.ParentCID)
+	}
+	if info.CreateType != "monolithicSparse" || info.AdapterType != "lsilogic" {
+		t.Errorf("got create type %q, adapter %q", info.CreateType, info.AdapterType)
+	}
+	if info.Geometry != (DiskGeometry{2, 16, 63}) {
+		t.Errorf("got geometry %+v", info.Geometry)
+	}
+	want := VMDKExtent{Access: "RW", Sectors: 2048, Type: "SPARSE", File: "diff-descriptor-s001.vmdk"}
+	if len(info.Extents) != 1 || info.Extents[0] != want {
+		t.Errorf("got extents %+v", info.Extents)
+	}
+	if info.Capacity() != 1<<20 {
+		t.Errorf("got capacity %d", info.Capacity())
+	}
+	if got := info.ParentPath(); got != filepath.Join("testdata", "base.vmdk") {
+		t.Errorf("got parent path %q", got)
+	}
+	if got := info.DDB["ddb.uuid.parent"]; got != "5e8c1f0a-7b3d-4e29-8c61-0f9a8b7c6d5e" {
+		t.Errorf("got parent uuid %q", got)
+	}
+}
+
+func TestParseVMDKDescriptorFlatExtent(t *testing.T) {
+	info, err := ParseVMDKDescriptor(`createType="monolithicFlat"
+RW 4096 FLAT "disk-flat.vmdk" 0
+RDONLY 100 ZERO
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Extents) != 2 || info.Extents[0].Type != "FLAT" || info.Extents[1].Access != "RDONLY" {
+		t.Errorf("got extents %+v", info.Extents)
+	}
+	if _, err := ParseVMDKDescriptor("hello"); err == nil {
+		t.Error("expected an error for a text without createType")
+	}
+}
+
+func TestCheckDiskChainVMDK(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.vmdk")
+	f, err := os.Create(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := vmdk.WriteMonolithicSparse(f, strings.NewReader("data"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	info, err := InspectVMDK(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsBase() || info.Capacity() != 1<<20 {
+		t.Fatalf("got base image %+v", info)
+	}
+
+	desc, err := os.ReadFile("testdata/diff-descriptor.vmdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := filepath.Join(dir, "diff.vmdk")
+	link := strings.Replace(string(desc), "9b54e0d1", fmt.Sprintf("%08x", info.CID), 1)
+	os.WriteFile(diff, []byte(link), 0o644)
+	if err := CheckDiskChain(base, diff); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(diff, desc, 0o644)
+	var ce *ChainError
+	if err := CheckDiskChain(base, diff); !errors.As(err, &ce) || ce.Child != diff {
+		t.Errorf("got %v, want a chain error", err)
+	}
+	if err := CheckDiskChain(diff); !errors.As(err, &ce) {
+		t.Errorf("got %v, want a chain error for a chain without base", err)
+	}
+}
+
+func TestInspectVDIChain(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.vdi")
+	f, err := os.Create(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(make([]byte, 1<<20), "data"...)
+	if err := vdi.WriteDynamic(f, bytes.NewReader(data), 3<<20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	info, err := InspectVDI(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Type != "dynamic" || info.BlockSize != 1<<20 || info.Blocks != 3 || info.Allocated != 1 || !info.IsBase() {
+		t.Fatalf("got %+v", info)
+	}
+	if m := info.BlockMap; len(m) != 3 || m[0] != 0xffffffff || m[1] != 0 || m[2] != 0xffffffff {
+		t.Errorf("got block map %x", info.BlockMap)
+	}
+
+	// Make a differencing image of base by rewriting the header of a copy.
+	img, _ := os.ReadFile(base)
+	r, err := vdi.NewReader(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := r.Header
+	h.Type = vdi.TypeDiff
+	h.UUID[0]++
+	h.ParentUUID, h.ParentModifyUUID = r.Header.UUID, r.Header.ModifyUUID
+	var hb bytes.Buffer
+	binary.Write(&hb, binary.LittleEndian, h)
+	copy(img, hb.Bytes())
+	diff := filepath.Join(dir, "diff.vdi")
+	os.WriteFile(diff, img, 0o644)
+
+	if err := CheckDiskChain(base, diff); err != nil {
+		t.Fatal(err)
+	}
+	var ce *ChainError
+	if err := CheckDiskChain(diff, base); !errors.As(err, &ce) {
+		t.Errorf("got %v, want a chain error for a reversed chain", err)
+	}
+}
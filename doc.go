@@ -3,13 +3,20 @@ Package virtualbox implements wrappers to interact with VirtualBox.
 
 VirtualBox Machine State Transition
 
-A VirtualBox machine can be in one of the following states:
+A VirtualBox machine can be in one of the following stable states:
 
 	poweroff: The VM is powered off and no previous running state saved.
 	running: The VM is running.
 	paused: The VM is paused, but its state is not saved to disk. If you quit VirtualBox, the state will be lost.
 	saved: The VM is powered off, and the previous state is saved on disk.
 	aborted: The VM process crashed. This should happen very rarely.
+	aborted-saved: The VM process crashed, but a saved state is still available.
+	teleported: The VM was teleported to another host.
+	gurumeditation: The VM is stuck after a fatal error and can only be powered off.
+
+All other states, such as starting, stopping, saving, restoring or
+deletingsnapshot, are transient: the machine leaves them on its own. See
+MachineState.IsTransient and MachineState.IsOnline.
 
 VBoxManage supports the following transitions between states:
 
@@ -35,7 +42,35 @@ To make things simpler, the following transitions are used instead:
 
 The takeaway is we try our best to transit the virtual machine into the state
 you want it to be, and you only need to watch out for the potentially unsafe
-poweroff and reset.
+poweroff and reset. Requesting a transition the current state does not allow,
+e.g. starting a machine that is still saving, fails with a
+*StateTransitionError, which matches ErrInvalidState.
+
+Clients
+
+All commands are run by a Client, which holds the path to VBoxManage, extra
+environment variables, a logger and the Executor that actually starts the
+process. The package-level functions use DefaultClient, which honours the VBM
+and Verbose variables. Machines remember the Client they were loaded with.
+
+	vbox := virtualbox.NewClient("/opt/VirtualBox/VBoxManage")
+	m, err := vbox.GetMachines(ctx, "builder")
+
+Cancellation
+
+Every operation that runs VBoxManage takes a context.Context. When the context
+is cancelled or its deadline expires, the VBoxManage process is killed and the
+returned error wraps ctx.Err(), so it can be tested with errors.Is.
+
+Errors
+
+When VBoxManage fails, the error is a *VBoxError holding the exit code, stderr
+and the result code VBoxManage reported. Use errors.Is with ErrNotFound,
+ErrSessionLocked, ErrInvalidState, ErrAccessDenied or ErrBusy to classify it.
+
+A Client with a RetryPolicy retries commands that fail because a machine is
+locked by another session or a medium is busy, with exponential backoff.
+Other errors are returned immediately.
 
 */
 package virtualbox
@@ -0,0 +1,127 @@
+package virtualbox
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reErrorLine   = regexp.MustCompile(`^VBoxManage(?:\.exe)?: error: (.*)$`)
+	reErrorDetail = regexp.MustCompile(`^Details: code (\S+) \((0x[0-9a-fA-F]+)\), component ([^,\s]+), interface ([^,\s]+)(?:, callee ([^,\s]+))?`)
+	reErrorCtx    = regexp.MustCompile(`^Context: (.*)$`)
+	reLocked      = regexp.MustCompile(`already locked`)
+	reBusy        = regexp.MustCompile(`locked for (?:reading|writing) by another task|\bis busy\b`)
+)
+
+// Categories of VBoxManage failures to be tested with errors.Is.
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrSessionLocked = errors.New("machine is locked by another session")
+	ErrInvalidState  = errors.New("object is in an invalid state")
+	ErrAccessDenied  = errors.New("access denied")
+	ErrBusy          = errors.New("object is busy")
+)
+
+// VBoxError is returned when VBoxManage exits with an error. It carries the
+// diagnostics VBoxManage printed on stderr.
+type VBoxError struct {
+	Args      []string // Arguments VBoxManage was run with.
+	ExitCode  int      // Exit code of VBoxManage, -1 if unknown.
+	Stderr    string   // Raw standard error.
+	Message   string   // Human-readable error message(s).
+	Code      string   // Symbolic result code, e.g. VBOX_E_OBJECT_NOT_FOUND.
+	RC        uint32   // Numeric result code, e.g. 0x80bb0001.
+	Component string   // Component reporting the error, e.g. MachineWrap.
+	Interface string   // Interface reporting the error, e.g. IMachine.
+	Callee    string   // Callee reporting the error, e.g. nsISupports.
+	Context   string   // API call that failed, as reported by VBoxManage.
+	Err       error    // Underlying error from the Executor.
+}
+
+// Result codes VBoxManage reports, see the VirtualBox SDK reference.
+const (
+	rcObjectNotFound     = 0x80bb0001 // VBOX_E_OBJECT_NOT_FOUND
+	rcInvalidVMState     = 0x80bb0002 // VBOX_E_INVALID_VM_STATE
+	rcInvalidObjectState = 0x80bb0007 // VBOX_E_INVALID_OBJECT_STATE
+	rcAccessDenied       = 0x80070005 // E_ACCESSDENIED
+)
+
+// newVBoxError builds a VBoxError from a failed command and its stderr.
+func newVBoxError(args []string, stderr string, err error) *VBoxError {
+	e := &VBoxError{Args: args, ExitCode: -1, Stderr: stderr, Err: err}
+	var ec interface{ ExitCode() int }
+	if errors.As(err, &ec) {
+		e.ExitCode = ec.ExitCode()
+	}
+	var msgs []string
+	for _, line := range strings.Split(stderr, "\n") {
+		res := reErrorLine.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if res == nil {
+			continue
+		}
+		text := res[1]
+		if d := reErrorDetail.FindStringSubmatch(text); d != nil {
+			e.Code = d[1]
+			if rc, err := strconv.ParseUint(d[2][2:], 16, 32); err == nil {
+				e.RC = uint32(rc)
+			}
+			e.Component, e.Interface, e.Callee = d[3], d[4], d[5]
+			continue
+		}
+		if c := reErrorCtx.FindStringSubmatch(text); c != nil {
+			e.Context = c[1]
+			continue
+		}
+		msgs = append(msgs, text)
+	}
+	e.Message = strings.Join(msgs, "\n")
+	return e
+}
+
+func (e *VBoxError) Error() string {
+	cmd := "VBoxManage"
+	if len(e.Args) > 0 {
+		cmd += " " + e.Args[0]
+	}
+	msg := e.Message
+	if msg == "" {
+		msg = strings.TrimSpace(e.Stderr)
+	}
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s (%s %#x)", cmd, msg, e.Code, e.RC)
+	}
+	return fmt.Sprintf("%s: %s", cmd, msg)
+}
+
+// Unwrap returns the underlying error from the Executor.
+func (e *VBoxError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether e belongs to the category target, one of ErrNotFound,
+// ErrSessionLocked, ErrInvalidState, ErrAccessDenied, ErrBusy or
+// ErrMachineNotExist.
+func (e *VBoxError) Is(target error) bool {
+	switch target {
+	case ErrMachineNotExist:
+		return reMachineNotFound.MatchString(e.Message)
+	case ErrNotFound:
+		return e.RC == rcObjectNotFound || reMachineNotFound.MatchString(e.Message)
+	case ErrSessionLocked:
+		return reLocked.MatchString(e.Message)
+	case ErrInvalidState:
+		return e.RC == rcInvalidVMState ||
+			(e.RC == rcInvalidObjectState && !reLocked.MatchString(e.Message) && !reBusy.MatchString(e.Message))
+	case ErrAccessDenied:
+		return e.RC == rcAccessDenied
+	case ErrBusy:
+		return reBusy.MatchString(e.Message)
+	}
+	return false
+}
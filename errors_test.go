@@ -0,0 +1,98 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// exitStatus is a fake process exit error.
+type exitStatus int
+
+func (e exitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitStatus) ExitCode() int { return int(e) }
+
+const stderrNotFound = `VBoxManage: error: Could not find a registered machine named 'nope'
+VBoxManage: error: Details: code VBOX_E_OBJECT_NOT_FOUND (0x80bb0001), component VirtualBoxWrap, interface IVirtualBox, callee nsISupports
+VBoxManage: error: Context: "FindMachine(Bstr(a->argv[0]).raw(), machine.asOutParam())" at line 2781 of file VBoxManageInfo.cpp
+`
+
+const stderrLocked = `VBoxManage: error: The machine 'dev' is already locked for a session (or being unlocked)
+VBoxManage: error: Details: code VBOX_E_INVALID_OBJECT_STATE (0x80bb0007), component MachineWrap, interface IMachine, callee nsISupports
+VBoxManage: error: Context: "LockMachine(a->session, LockType_Write)" at line 525 of file VBoxManageModifyVM.cpp
+`
+
+const stderrInvalidState = `VBoxManage: error: Machine in invalid state 1 -- powered off
+`
+
+const stderrVMState = `VBoxManage: error: The machine 'dev' is already running
+VBoxManage: error: Details: code VBOX_E_INVALID_VM_STATE (0x80bb0002), component MachineWrap, interface IMachine
+`
+
+const stderrAccess = `VBoxManage: error: Could not open the medium '/root/disk.vdi'.
+VBoxManage: error: Details: code E_ACCESSDENIED (0x80070005), component MediumWrap, interface IMedium, callee nsISupports
+`
+
+func TestVBoxErrorParse(t *testing.T) {
+	e := newVBoxError([]string{"showvminfo", "nope"}, stderrNotFound, exitStatus(1))
+	if e.ExitCode != 1 {
+		t.Errorf("ExitCode = %d, want 1", e.ExitCode)
+	}
+	if e.Code != "VBOX_E_OBJECT_NOT_FOUND" || e.RC != 0x80bb0001 {
+		t.Errorf("got code %s %#x", e.Code, e.RC)
+	}
+	if e.Component != "VirtualBoxWrap" || e.Interface != "IVirtualBox" || e.Callee != "nsISupports" {
+		t.Errorf("got component %q interface %q callee %q", e.Component, e.Interface, e.Callee)
+	}
+	if e.Message != "Could not find a registered machine named 'nope'" {
+		t.Errorf("Message = %q", e.Message)
+	}
+	if e.Context == "" {
+		t.Error("Context is empty")
+	}
+	want := "VBoxManage showvminfo: Could not find a registered machine named 'nope' (VBOX_E_OBJECT_NOT_FOUND 0x80bb0001)"
+	if e.Error() != want {
+		t.Errorf("Error() = %q, want %q", e.Error(), want)
+	}
+}
+
+func TestVBoxErrorIs(t *testing.T) {
+	all := []error{ErrNotFound, ErrMachineNotExist, ErrSessionLocked, ErrInvalidState, ErrAccessDenied}
+	tests := []struct {
+		stderr string
+		want   []error
+	}{
+		{stderrNotFound, []error{ErrNotFound, ErrMachineNotExist}},
+		{stderrLocked, []error{ErrSessionLocked}},
+		{stderrVMState, []error{ErrInvalidState}},
+		{stderrAccess, []error{ErrAccessDenied}},
+		{stderrInvalidState, nil},
+	}
+	for _, tt := range tests {
+		err := error(newVBoxError([]string{"modifyvm"}, tt.stderr, exitStatus(1)))
+		for _, target := range all {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == target
+			}
+			if got := errors.Is(err, target); got != want {
+				t.Errorf("errors.Is(%q, %v) = %v, want %v", err, target, got, want)
+			}
+		}
+	}
+}
+
+func TestGetMachineNotFound(t *testing.T) {
+	f := newFakeVBM()
+	f.stderr["showvminfo nope --machinereadable"] = stderrNotFound
+	f.errs["showvminfo nope --machinereadable"] = exitStatus(1)
+	_, err := f.client().getMachine(context.Background(), "nope")
+	if !errors.Is(err, ErrMachineNotExist) {
+		t.Fatalf("got %v, want ErrMachineNotExist", err)
+	}
+	var ve *VBoxError
+	if !errors.As(err, &ve) || ve.ExitCode != 1 {
+		t.Fatalf("got %#v, want *VBoxError with exit code 1", err)
+	}
+}
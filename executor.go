@@ -0,0 +1,58 @@
+package virtualbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Command describes a single invocation of VBoxManage.
+type Command struct {
+	Path   string    // Path to the VBoxManage executable.
+	Args   []string  // Arguments, not including the executable itself.
+	Env    []string  // Environment in "key=value" form. Nil inherits the current process's.
+	Stdin  io.Reader // Nil means no input.
+	Stdout io.Writer // Nil discards the output.
+	Stderr io.Writer // Nil discards the output.
+}
+
+// Executor runs VBoxManage commands on behalf of a Client. Implementations
+// other than the default one can record, replay or fake VBoxManage, e.g. in
+// tests.
+type Executor interface {
+	// Exec runs cmd and waits for it to complete. It must stop the command
+	// and return once ctx is done.
+	Exec(ctx context.Context, cmd *Command) error
+}
+
+// ExecFunc adapts an ordinary function to the Executor interface.
+type ExecFunc func(ctx context.Context, cmd *Command) error
+
+// Exec calls f(ctx, cmd).
+func (f ExecFunc) Exec(ctx context.Context, cmd *Command) error {
+	return f(ctx, cmd)
+}
+
+// waitDelay bounds how long a killed VBoxManage process may keep its output
+// pipes open (e.g. through orphaned children) before Wait gives up.
+const waitDelay = 5 * time.Second
+
+// LocalExecutor runs VBoxManage as a child process of the current process.
+// The process is killed when the context is cancelled or its deadline
+// expires.
+type LocalExecutor struct{}
+
+// Exec implements Executor.
+func (LocalExecutor) Exec(ctx context.Context, c *Command) error {
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.WaitDelay = waitDelay
+	if c.Env != nil {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	return cmd.Run()
+}
@@ -1,11 +1,23 @@
 package virtualbox
 
+import "context"
+
+// SetExtra sets extra data. Name could be "global"|<uuid>|<vmname>
+func SetExtra(ctx context.Context, name, key, val string) error {
+	return DefaultClient.SetExtra(ctx, name, key, val)
+}
+
 // SetExtra sets extra data. Name could be "global"|<uuid>|<vmname>
-func SetExtra(name, key, val string) error {
-	return vbm("setextradata", name, key, val)
+func (c *Client) SetExtra(ctx context.Context, name, key, val string) error {
+	return c.vbm(ctx, "setextradata", name, key, val)
+}
+
+// DelExtraData deletes extra data. Name could be "global"|<uuid>|<vmname>
+func DelExtra(ctx context.Context, name, key string) error {
+	return DefaultClient.DelExtra(ctx, name, key)
 }
 
 // DelExtraData deletes extra data. Name could be "global"|<uuid>|<vmname>
-func DelExtra(name, key string) error {
-	return vbm("setextradata", name, key)
+func (c *Client) DelExtra(ctx context.Context, name, key string) error {
+	return c.vbm(ctx, "setextradata", name, key)
 }
@@ -2,12 +2,14 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 var (
@@ -29,57 +31,191 @@ type HostonlyNet struct {
 	Medium      string
 	Status      string
 	NetworkName string // referenced in DHCP.NetworkName
+
+	client *Client
+}
+
+// checkHostonlyIfs returns ErrHostonlyNetworkUnsupported if the VirtualBox
+// host has no host-only interfaces, and err otherwise. VirtualBox 7 on macOS
+// only has host-only networks; see HostonlyNetworks. It is only called once a
+// host-only interface command failed, so working hosts pay nothing for it.
+func (c *Client) checkHostonlyIfs(ctx context.Context, err error) error {
+	major, verr := c.majorVersion(ctx)
+	if verr != nil || major < 7 {
+		return err
+	}
+	if hostOS, herr := c.hostOS(ctx); herr != nil || !strings.HasPrefix(hostOS, "Darwin") {
+		return err
+	}
+	return fmt.Errorf("%w: VirtualBox %d on macOS has no host-only interfaces, use HostonlyNetworks instead",
+		ErrHostonlyNetworkUnsupported, major)
 }
 
-// CreateHostonlyNet creates a new host-only network.
-func CreateHostonlyNet() (*HostonlyNet, error) {
-	out, err := vbmOut("hostonlyif", "create")
+// CreateHostonlyNet creates a new host-only network interface. It returns
+// ErrHostonlyNetworkUnsupported on VirtualBox 7 for macOS, which only has
+// host-only networks; use CreateHostonlyNetwork there.
+func CreateHostonlyNet(ctx context.Context) (*HostonlyNet, error) {
+	return DefaultClient.CreateHostonlyNet(ctx)
+}
+
+// CreateHostonlyNet creates a new host-only network interface. It returns
+// ErrHostonlyNetworkUnsupported on VirtualBox 7 for macOS, which only has
+// host-only networks; use CreateHostonlyNetwork there.
+func (c *Client) CreateHostonlyNet(ctx context.Context) (*HostonlyNet, error) {
+	out, err := c.vbmOut(ctx, "hostonlyif", "create")
 	if err != nil {
-		return nil, err
+		return nil, c.checkHostonlyIfs(ctx, err)
 	}
 	res := reHostonlyInterfaceCreated.FindStringSubmatch(string(out))
 	if res == nil {
-		return nil, ErrHostonlyInterfaceCreation
+		return nil, c.checkHostonlyIfs(ctx, ErrHostonlyInterfaceCreation)
+	}
+	return &HostonlyNet{Name: res[1], client: c}, nil
+}
+
+// RemoveHostonlyNet removes the host-only network interface with the given
+// name, e.g. vboxnet0.
+func RemoveHostonlyNet(ctx context.Context, name string) error {
+	return DefaultClient.RemoveHostonlyNet(ctx, name)
+}
+
+// RemoveHostonlyNet removes the host-only network interface with the given
+// name, e.g. vboxnet0.
+func (c *Client) RemoveHostonlyNet(ctx context.Context, name string) error {
+	return c.vbm(ctx, "hostonlyif", "remove", name)
+}
+
+// ensureMu serializes EnsureHostonlyNet so concurrent calls for the same
+// network do not both create an interface. It only covers callers in this
+// process; other processes running VBoxManage can still race with it. It is
+// global rather than per Client because host-only interfaces belong to the
+// host, and separate Clients usually manage the same VirtualBox host.
+var ensureMu sync.Mutex
+
+// sameIPv4Net reports whether a and b have the same IPv4 address and prefix
+// length, whether their address and mask are stored in 4 or 16 bytes.
+func sameIPv4Net(a, b net.IPNet) bool {
+	ipA, ipB := a.IP.To4(), b.IP.To4()
+	if ipA == nil || !ipA.Equal(ipB) {
+		return false
+	}
+	onesA, okA := ipv4PrefixLen(a.Mask)
+	onesB, okB := ipv4PrefixLen(b.Mask)
+	return okA && okB && onesA == onesB
+}
+
+// ipv4PrefixLen returns the prefix length of an IPv4 mask, which may also be
+// stored as an IPv4-mapped address or as the last 32 bits of a 128-bit mask.
+func ipv4PrefixLen(m net.IPMask) (int, bool) {
+	if len(m) == net.IPv6len {
+		if ip4 := net.IP(m).To4(); ip4 != nil {
+			m = net.IPMask(ip4)
+		}
+	}
+	ones, bits := m.Size()
+	if bits == 8*net.IPv6len && ones >= 96 {
+		ones, bits = ones-96, 8*net.IPv4len
+	}
+	return ones, bits == 8*net.IPv4len
+}
+
+// EnsureHostonlyNet returns a host-only network whose host address and mask
+// are ipnet, e.g. 192.168.56.1/24. It reuses an existing interface with that
+// IPv4 configuration, or creates and configures a new one. Concurrent calls
+// are serialized within the process, but not across processes. Like
+// HostonlyNets, it returns ErrHostonlyNetworkUnsupported on VirtualBox 7 for
+// macOS; use CreateHostonlyNetwork there.
+func EnsureHostonlyNet(ctx context.Context, ipnet net.IPNet) (*HostonlyNet, error) {
+	return DefaultClient.EnsureHostonlyNet(ctx, ipnet)
+}
+
+// EnsureHostonlyNet returns a host-only network whose host address and mask
+// are ipnet, e.g. 192.168.56.1/24. It reuses an existing interface with that
+// IPv4 configuration, or creates and configures a new one. Concurrent calls
+// are serialized within the process, but not across processes. Like
+// HostonlyNets, it returns ErrHostonlyNetworkUnsupported on VirtualBox 7 for
+// macOS; use CreateHostonlyNetwork there.
+func (c *Client) EnsureHostonlyNet(ctx context.Context, ipnet net.IPNet) (*HostonlyNet, error) {
+	ones, ok := ipv4PrefixLen(ipnet.Mask)
+	if !ok || ipnet.IP.To4() == nil {
+		return nil, fmt.Errorf("host-only network %s: not an IPv4 address and mask", ipnet.String())
+	}
+	ipnet = net.IPNet{IP: ipnet.IP.To4(), Mask: net.CIDRMask(ones, 8*net.IPv4len)}
+
+	ensureMu.Lock()
+	defer ensureMu.Unlock()
+
+	nets, err := c.HostonlyNets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nets {
+		if sameIPv4Net(n.IPv4, ipnet) {
+			return n, nil
+		}
 	}
-	return &HostonlyNet{Name: res[1]}, nil
+
+	n, err := c.CreateHostonlyNet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	n.IPv4 = ipnet
+	if err := n.Config(ctx); err != nil {
+		// Do not leak the interface we just created.
+		if rerr := c.RemoveHostonlyNet(ctx, n.Name); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	return n, nil
 }
 
 // Config changes the configuration of the host-only network.
-func (n *HostonlyNet) Config() error {
+func (n *HostonlyNet) Config(ctx context.Context) error {
+	c := n.client.orDefault()
 	if n.IPv4.IP != nil && n.IPv4.Mask != nil {
-		if err := vbm("hostonlyif", "ipconfig", n.Name, "--ip", n.IPv4.IP.String(), "--netmask", net.IP(n.IPv4.Mask).String()); err != nil {
+		if err := c.vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--ip", n.IPv4.IP.String(), "--netmask", net.IP(n.IPv4.Mask).String()); err != nil {
 			return err
 		}
 	}
 
 	if n.IPv6.IP != nil && n.IPv6.Mask != nil {
 		prefixLen, _ := n.IPv6.Mask.Size()
-		if err := vbm("hostonlyif", "ipconfig", n.Name, "--ipv6", n.IPv6.IP.String(), "--netmasklengthv6", fmt.Sprintf("%d", prefixLen)); err != nil {
+		if err := c.vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--ipv6", n.IPv6.IP.String(), "--netmasklengthv6", fmt.Sprintf("%d", prefixLen)); err != nil {
 			return err
 		}
 	}
 
 	if n.DHCP {
-		vbm("hostonlyif", "ipconfig", n.Name, "--dhcp") // not implemented as of VirtualBox 4.3
+		c.vbm(ctx, "hostonlyif", "ipconfig", n.Name, "--dhcp") // not implemented as of VirtualBox 4.3
 	}
 
 	return nil
 }
 
 // HostonlyNets gets all host-only networks in a  map keyed by HostonlyNet.NetworkName.
-func HostonlyNets() (map[string]*HostonlyNet, error) {
-	out, err := vbmOut("list", "hostonlyifs")
+// It returns ErrHostonlyNetworkUnsupported on VirtualBox 7 for macOS, which
+// only has host-only networks; use HostonlyNetworks there.
+func HostonlyNets(ctx context.Context) (map[string]*HostonlyNet, error) {
+	return DefaultClient.HostonlyNets(ctx)
+}
+
+// HostonlyNets gets all host-only networks in a  map keyed by HostonlyNet.NetworkName.
+// It returns ErrHostonlyNetworkUnsupported on VirtualBox 7 for macOS, which
+// only has host-only networks; use HostonlyNetworks there.
+func (c *Client) HostonlyNets(ctx context.Context) (map[string]*HostonlyNet, error) {
+	out, err := c.vbmOut(ctx, "list", "hostonlyifs")
 	if err != nil {
-		return nil, err
+		return nil, c.checkHostonlyIfs(ctx, err)
 	}
 	s := bufio.NewScanner(strings.NewReader(out))
 	m := map[string]*HostonlyNet{}
-	n := &HostonlyNet{}
+	n := &HostonlyNet{client: c}
 	for s.Scan() {
 		line := s.Text()
 		if line == "" {
 			m[n.NetworkName] = n
-			n = &HostonlyNet{}
+			n = &HostonlyNet{client: c}
 			continue
 		}
 		res := reColonLine.FindStringSubmatch(line)
@@ -1,9 +1,18 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
 
 func TestHostonlyNets(t *testing.T) {
-	m, err := HostonlyNets()
+	m, err := HostonlyNets(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -11,3 +20,144 @@ func TestHostonlyNets(t *testing.T) {
 		t.Logf("%+v", n)
 	}
 }
+
+// fakeHostonlyIfs is an Executor keeping host-only interfaces in memory.
+type fakeHostonlyIfs struct {
+	mu      sync.Mutex
+	ifs     []*HostonlyNet
+	created int
+}
+
+func (f *fakeHostonlyIfs) Exec(ctx context.Context, cmd *Command) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch args := cmd.Args; strings.Join(args[:2], " ") {
+	case "list hostonlyifs":
+		for _, n := range f.ifs {
+			fmt.Fprintf(cmd.Stdout, "Name:            %s\nIPAddress:       %s\nNetworkMask:     %s\nVBoxNetworkName: HostInterfaceNetworking-%s\n\n",
+				n.Name, n.IPv4.IP, net.IP(n.IPv4.Mask), n.Name)
+		}
+	case "hostonlyif create":
+		name := fmt.Sprintf("vboxnet%d", len(f.ifs))
+		f.ifs = append(f.ifs, &HostonlyNet{Name: name})
+		f.created++
+		fmt.Fprintf(cmd.Stdout, "Interface '%s' was successfully created\n", name)
+	case "hostonlyif ipconfig":
+		for _, n := range f.ifs {
+			if n.Name == args[2] {
+				n.IPv4 = net.IPNet{IP: net.ParseIP(args[4]), Mask: ParseIPv4Mask(args[6])}
+			}
+		}
+	case "hostonlyif remove":
+		for i, n := range f.ifs {
+			if n.Name == args[2] {
+				f.ifs = append(f.ifs[:i], f.ifs[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func TestEnsureHostonlyNet(t *testing.T) {
+	f := &fakeHostonlyIfs{}
+	c := &Client{Executor: f}
+	ctx := context.Background()
+	ip, ipnet, _ := net.ParseCIDR("192.168.57.1/24")
+	ipnet.IP = ip
+
+	var wg sync.WaitGroup
+	names := make([]string, 8)
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			n, err := c.EnsureHostonlyNet(ctx, *ipnet)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			names[i] = n.Name
+		}(i)
+	}
+	wg.Wait()
+	if f.created != 1 {
+		t.Fatalf("created %d interfaces, want 1", f.created)
+	}
+	for _, name := range names {
+		if name != "vboxnet0" {
+			t.Fatalf("got interfaces %q, want vboxnet0 only", names)
+		}
+	}
+
+	// The same network with 16-byte addresses and masks is found again.
+	for _, mask := range []net.IPMask{net.IPMask(net.ParseIP("255.255.255.0")), net.CIDRMask(120, 128)} {
+		n, err := c.EnsureHostonlyNet(ctx, net.IPNet{IP: net.ParseIP("192.168.57.1"), Mask: mask})
+		if err != nil || n.Name != "vboxnet0" {
+			t.Fatalf("mask %s: got %+v, %v", mask, n, err)
+		}
+	}
+	if f.created != 1 {
+		t.Fatalf("created %d interfaces, want 1", f.created)
+	}
+
+	if err := c.RemoveHostonlyNet(ctx, "vboxnet0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.ifs) != 0 {
+		t.Errorf("interfaces left after removal: %+v", f.ifs)
+	}
+}
+
+func TestEnsureHostonlyNetCleanupError(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["hostonlyif create"] = "Interface 'vboxnet1' was successfully created\n"
+	errConfig := errors.New("ipconfig failed")
+	errRemove := errors.New("remove failed")
+	f.errs["hostonlyif ipconfig vboxnet1 --ip 192.168.58.1 --netmask 255.255.255.0"] = errConfig
+	f.errs["hostonlyif remove vboxnet1"] = errRemove
+	ip, ipnet, _ := net.ParseCIDR("192.168.58.1/24")
+	ipnet.IP = ip
+	_, err := f.client().EnsureHostonlyNet(context.Background(), *ipnet)
+	if !errors.Is(err, errConfig) || !errors.Is(err, errRemove) {
+		t.Errorf("got %v, want both the ipconfig and the remove error", err)
+	}
+}
+
+func TestHostonlyNetsUnsupported(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["--version"] = "7.0.10r158379\n"
+	f.stdout["list hostinfo"] = "Host Information:\n\nOperating system: Darwin\nOperating system version: 23.1.0\n"
+	f.errs["list hostonlyifs"] = errors.New("exit status 1")
+	f.errs["hostonlyif create"] = errors.New("exit status 1")
+	c := f.client()
+	ctx := context.Background()
+	if _, err := c.HostonlyNets(ctx); !errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("HostonlyNets: got %v, want ErrHostonlyNetworkUnsupported", err)
+	}
+	if _, err := c.CreateHostonlyNet(ctx); !errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("CreateHostonlyNet: got %v, want ErrHostonlyNetworkUnsupported", err)
+	}
+	_, ipnet, _ := net.ParseCIDR("192.168.56.1/24")
+	if _, err := c.EnsureHostonlyNet(ctx, *ipnet); !errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("EnsureHostonlyNet: got %v, want ErrHostonlyNetworkUnsupported", err)
+	}
+	// The host is only probed once, after the first failure.
+	want := [][]string{
+		{"list", "hostonlyifs"}, {"--version"}, {"list", "hostinfo"},
+		{"hostonlyif", "create"},
+		{"list", "hostonlyifs"},
+	}
+	if !reflect.DeepEqual(f.calls, want) {
+		t.Errorf("got calls %q, want %q", f.calls, want)
+	}
+
+	// Other hosts get the original error.
+	f = newFakeVBM()
+	f.stdout["--version"] = "7.0.10r158379\n"
+	f.stdout["list hostinfo"] = "Host Information:\n\nOperating system: Linux\n"
+	f.errs["list hostonlyifs"] = errors.New("exit status 1")
+	if _, err := f.client().HostonlyNets(ctx); err == nil || errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("got %v, want the VBoxManage error", err)
+	}
+}
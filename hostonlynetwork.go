@@ -0,0 +1,162 @@
+package virtualbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrHostonlyNetworkUnsupported is returned when the VirtualBox host lacks the
+// kind of host-only networking asked for: host-only networks (HostonlyNetworks)
+// need VirtualBox 7.0 or later, and VirtualBox 7 on macOS replaced host-only
+// interfaces (HostonlyNets) with them.
+var ErrHostonlyNetworkUnsupported = errors.New("host-only networking not supported")
+
+// HostonlyNetwork is a host-only network of VirtualBox 7, which replaces
+// host-only interfaces on some hosts. Guests get addresses between LowerIP
+// and UpperIP.
+type HostonlyNetwork struct {
+	Name        string
+	GUID        string
+	Mask        net.IPMask
+	LowerIP     net.IP
+	UpperIP     net.IP
+	Enabled     bool
+	NetworkName string // internal network name, e.g. hostonly-HostNet
+
+	client *Client
+}
+
+// checkHostonlyNetworks returns ErrHostonlyNetworkUnsupported if VirtualBox
+// is too old for host-only networks.
+func (c *Client) checkHostonlyNetworks(ctx context.Context) error {
+	major, err := c.majorVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if major < 7 {
+		return fmt.Errorf("%w: host-only networks need VirtualBox 7.0 or later", ErrHostonlyNetworkUnsupported)
+	}
+	return nil
+}
+
+// HostonlyNetworks gets all host-only networks in a map keyed by
+// HostonlyNetwork.Name.
+func HostonlyNetworks(ctx context.Context) (map[string]*HostonlyNetwork, error) {
+	return DefaultClient.HostonlyNetworks(ctx)
+}
+
+// HostonlyNetworks gets all host-only networks in a map keyed by
+// HostonlyNetwork.Name.
+func (c *Client) HostonlyNetworks(ctx context.Context) (map[string]*HostonlyNetwork, error) {
+	if err := c.checkHostonlyNetworks(ctx); err != nil {
+		return nil, err
+	}
+	out, err := c.vbmOut(ctx, "list", "hostonlynets")
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]*HostonlyNetwork{}
+	var n *HostonlyNetwork
+	flush := func() {
+		if n != nil && n.Name != "" {
+			m[n.Name] = n
+		}
+		n = nil
+	}
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		// Records start with their name; VBoxManage also prints a blank line
+		// after the GUID of every network.
+		res := reColonLine.FindStringSubmatch(strings.TrimRight(s.Text(), "\r"))
+		if res == nil {
+			continue
+		}
+		key, val := res[1], res[2]
+		if key == "Name" {
+			flush()
+			n = &HostonlyNetwork{Name: val, client: c}
+			continue
+		}
+		if n == nil {
+			continue
+		}
+		switch key {
+		case "GUID":
+			n.GUID = val
+		case "State":
+			n.Enabled = val == "Enabled"
+		case "NetworkMask":
+			n.Mask = ParseIPv4Mask(val)
+		case "LowerIP":
+			n.LowerIP = net.ParseIP(val)
+		case "UpperIP":
+			n.UpperIP = net.ParseIP(val)
+		case "VBoxNetworkName":
+			n.NetworkName = val
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return m, nil
+}
+
+// CreateHostonlyNetwork creates a host-only network with the settings of n.
+func CreateHostonlyNetwork(ctx context.Context, n HostonlyNetwork) (*HostonlyNetwork, error) {
+	return DefaultClient.CreateHostonlyNetwork(ctx, n)
+}
+
+// CreateHostonlyNetwork creates a host-only network with the settings of n.
+func (c *Client) CreateHostonlyNetwork(ctx context.Context, n HostonlyNetwork) (*HostonlyNetwork, error) {
+	if err := c.checkHostonlyNetworks(ctx); err != nil {
+		return nil, err
+	}
+	n.client = c
+	if err := c.vbm(ctx, append([]string{"hostonlynet", "add"}, n.args()...)...); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// args returns the hostonlynet add/modify options for the settings of n.
+func (n *HostonlyNetwork) args() []string {
+	args := []string{"--name", n.Name}
+	if n.Mask != nil {
+		args = append(args, "--netmask", net.IP(n.Mask).String())
+	}
+	if n.LowerIP != nil {
+		args = append(args, "--lower-ip", n.LowerIP.String())
+	}
+	if n.UpperIP != nil {
+		args = append(args, "--upper-ip", n.UpperIP.String())
+	}
+	if n.Enabled {
+		args = append(args, "--enable")
+	} else {
+		args = append(args, "--disable")
+	}
+	return args
+}
+
+// Modify applies the settings of n to the host-only network named n.Name.
+func (n *HostonlyNetwork) Modify(ctx context.Context) error {
+	c := n.client.orDefault()
+	if err := c.checkHostonlyNetworks(ctx); err != nil {
+		return err
+	}
+	return c.vbm(ctx, append([]string{"hostonlynet", "modify"}, n.args()...)...)
+}
+
+// Remove deletes the host-only network.
+func (n *HostonlyNetwork) Remove(ctx context.Context) error {
+	c := n.client.orDefault()
+	if err := c.checkHostonlyNetworks(ctx); err != nil {
+		return err
+	}
+	return c.vbm(ctx, "hostonlynet", "remove", "--name", n.Name)
+}
@@ -0,0 +1,96 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostonlyNetworks(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["--version"] = "7.0.10r158379\n"
+	f.stdout["list hostonlynets"] = readFixture(t, "hostonlynets.txt")
+	c := f.client()
+	ctx := context.Background()
+	nets, err := c.HostonlyNetworks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := nets["HostNet"]
+	if n == nil || len(nets) != 2 {
+		t.Fatalf("got %+v", nets)
+	}
+	want := HostonlyNetwork{
+		Name:        "HostNet",
+		GUID:        "3e4f8a2c-6d1b-4c7e-9a05-b8d2f1e6c307",
+		Mask:        net.IPv4Mask(255, 255, 255, 0),
+		LowerIP:     net.ParseIP("192.168.56.2"),
+		UpperIP:     net.ParseIP("192.168.56.199"),
+		Enabled:     true,
+		NetworkName: "hostonly-HostNet",
+		client:      n.client,
+	}
+	if !reflect.DeepEqual(*n, want) {
+		t.Errorf("got %+v, want %+v", *n, want)
+	}
+	if p := nets["perf"]; p.Enabled || !p.UpperIP.Equal(net.ParseIP("172.20.255.250")) {
+		t.Errorf("got %+v", p)
+	}
+
+	f.calls = nil
+	created, err := c.CreateHostonlyNetwork(ctx, HostonlyNetwork{
+		Name:    "ci",
+		Mask:    net.IPv4Mask(255, 255, 255, 0),
+		LowerIP: net.ParseIP("192.168.60.10"),
+		UpperIP: net.ParseIP("192.168.60.100"),
+		Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created.Enabled = false
+	if err := created.Modify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := created.Remove(ctx); err != nil {
+		t.Fatal(err)
+	}
+	m := &machine{client: c, name: "guest"}
+	if err := m.SetNIC(ctx, 2, NIC{Network: NICNetHostonlyNet, Hardware: VirtIO, HostonlyNetwork: "ci"}); err != nil {
+		t.Fatal(err)
+	}
+	// The version was read and cached when listing the networks.
+	wantCalls := []string{
+		"hostonlynet add --name ci --netmask 255.255.255.0 --lower-ip 192.168.60.10 --upper-ip 192.168.60.100 --enable",
+		"hostonlynet modify --name ci --netmask 255.255.255.0 --lower-ip 192.168.60.10 --upper-ip 192.168.60.100 --disable",
+		"hostonlynet remove --name ci",
+		"modifyvm guest --nic2 hostonlynet --nictype2 virtio --cableconnected2 on --host-only-net2 ci",
+	}
+	var got []string
+	for _, args := range f.calls {
+		got = append(got, strings.Join(args, " "))
+	}
+	if !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("got %q, want %q", got, wantCalls)
+	}
+}
+
+func TestHostonlyNetworksUnsupported(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["--version"] = "6.1.46r158378\n"
+	c := f.client()
+	ctx := context.Background()
+	if _, err := c.HostonlyNetworks(ctx); !errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("got %v, want ErrHostonlyNetworkUnsupported", err)
+	}
+	m := &machine{client: c, name: "guest"}
+	if err := m.SetNIC(ctx, 1, NIC{Network: NICNetHostonlyNet, HostonlyNetwork: "ci"}); !errors.Is(err, ErrHostonlyNetworkUnsupported) {
+		t.Errorf("got %v, want ErrHostonlyNetworkUnsupported", err)
+	}
+	if len(f.calls) != 1 {
+		t.Errorf("got calls %q, want a single version check", f.calls)
+	}
+}
@@ -2,23 +2,12 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
-type MachineState string
-
-const (
-	Poweroff = MachineState("poweroff")
-	Running  = MachineState("running")
-	Paused   = MachineState("paused")
-	Saved    = MachineState("saved")
-	Aborted  = MachineState("aborted")
-)
-
 type Flag int
 
 // Flag names in lowercases to be consistent with VBoxManage options.
@@ -40,6 +29,38 @@ const (
 	F_accelerate3d
 )
 
+// flagNames lists the VBoxManage option name of every Flag, in the order
+// they are passed to modifyvm.
+var flagNames = []struct {
+	flag Flag
+	name string
+}{
+	{F_acpi, "acpi"},
+	{F_ioapic, "ioapic"},
+	{F_rtcuseutc, "rtcuseutc"},
+	{F_cpuhotplug, "cpuhotplug"},
+	{F_pae, "pae"},
+	{F_longmode, "longmode"},
+	{F_synthcpu, "synthcpu"},
+	{F_hpet, "hpet"},
+	{F_hwvirtex, "hwvirtex"},
+	{F_triplefaultreset, "triplefaultreset"},
+	{F_nestedpaging, "nestedpaging"},
+	{F_largepages, "largepages"},
+	{F_vtxvpid, "vtxvpid"},
+	{F_vtxux, "vtxux"},
+	{F_accelerate3d, "accelerate3d"},
+}
+
+// flagByName maps VBoxManage option names to flags.
+var flagByName = map[string]Flag{}
+
+func init() {
+	for _, f := range flagNames {
+		flagByName[f.name] = f.flag
+	}
+}
+
 // Convert bool to "on"/"off"
 func bool2string(b bool) string {
 	if b {
@@ -48,6 +69,12 @@ func bool2string(b bool) string {
 	return "off"
 }
 
+// Bool returns a pointer to b, for optional settings such as those of
+// StorageMedium.
+func Bool(b bool) *bool {
+	return &b
+}
+
 // Test if flag is set. Return "on" or "off".
 func (f Flag) Get(o Flag) string {
 	return bool2string(f&o == o)
@@ -55,6 +82,7 @@ func (f Flag) Get(o Flag) string {
 
 // Machine information.
 type machine struct {
+	client     *Client
 	name       string
 	uUID       string
 	state      MachineState
@@ -66,15 +94,16 @@ type machine struct {
 	oSType     string
 	flag       Flag
 	bootOrder  []string // max 4 slots, each in {none|floppy|dvd|disk|net}
+	info       *MachineInfo
 }
 
 // Refresh reloads the machine information.
-func (m *machine) Refresh() error {
+func (m *machine) Refresh(ctx context.Context) error {
 	id := m.name
 	if id == "" {
 		id = m.uUID
 	}
-	mm, err := getMachine(id)
+	mm, err := m.client.getMachine(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -83,167 +112,252 @@ func (m *machine) Refresh() error {
 }
 
 // Start starts the machine.
-func (m *machine) Start() error {
-	switch m.state {
-	case Paused:
-		return vbm("controlvm", m.name, "resume")
-	case Poweroff, Saved, Aborted:
-		return vbm("startvm", m.name, "--type", "headless")
+func (m *machine) Start(ctx context.Context) error {
+	if t, err := m.transition(OpStart); t != direct {
+		return err
 	}
-	return nil
+	if m.state == Paused {
+		return m.client.vbm(ctx, "controlvm", m.name, "resume")
+	}
+	return m.client.vbm(ctx, "startvm", m.name, "--type", "headless")
+}
+
+// resume starts or resumes the machine and waits until it has left the
+// transient states in between.
+func (m *machine) resume(ctx context.Context) error {
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+	return m.WaitForState(ctx, Running, Aborted, AbortedSaved, GuruMeditation)
 }
 
 // Suspend suspends the machine and saves its state to disk.
-func (m *machine) Save() error {
-	switch m.state {
-	case Paused:
-		if err := m.Start(); err != nil {
+func (m *machine) Save(ctx context.Context) error {
+	switch t, err := m.transition(OpSave); t {
+	case illegal, noop:
+		return err
+	case startFirst:
+		if err := m.resume(ctx); err != nil {
 			return err
 		}
-	case Poweroff, Aborted, Saved:
-		return nil
 	}
-	return vbm("controlvm", m.name, "savestate")
+	return m.client.vbm(ctx, "controlvm", m.name, "savestate")
 }
 
 // Pause pauses the execution of the machine.
-func (m *machine) Pause() error {
-	switch m.state {
-	case Paused, Poweroff, Aborted, Saved:
-		return nil
+func (m *machine) Pause(ctx context.Context) error {
+	if t, err := m.transition(OpPause); t != direct {
+		return err
 	}
-	return vbm("controlvm", m.name, "pause")
+	return m.client.vbm(ctx, "controlvm", m.name, "pause")
 }
 
-// Stop gracefully stops the machine.
-func (m *machine) Stop() error {
-	switch m.state {
-	case Poweroff, Aborted, Saved:
-		return nil
-	case Paused:
-		if err := m.Start(); err != nil {
+// StopFallback is what StopWithOptions does when the guest fails to power off
+// within the grace period.
+type StopFallback string
+
+const (
+	StopFallbackNone     = StopFallback("")          // Return a *StopTimeoutError.
+	StopFallbackPoweroff = StopFallback("poweroff")  // Power off the machine (unsafe).
+	StopFallbackSave     = StopFallback("savestate") // Save the machine state.
+)
+
+// StopOptions controls how StopWithOptions shuts down a machine.
+type StopOptions struct {
+	Timeout  time.Duration // Grace period for the guest to power off; 0 waits until the context is done.
+	Interval time.Duration // How often to press the power button and poll the state; 0 means the client's PollInterval.
+	Fallback StopFallback  // Action taken when Timeout expires.
+}
+
+// StopTimeoutError is returned when a machine did not power off within the
+// grace period and no fallback was configured.
+type StopTimeoutError struct {
+	Machine string
+	Timeout time.Duration
+	State   MachineState // last observed state
+}
+
+func (e *StopTimeoutError) Error() string {
+	return fmt.Sprintf("machine %s did not power off within %v (state %s)", e.Machine, e.Timeout, e.State)
+}
+
+// Stop gracefully stops the machine. It waits until the guest powers off or
+// ctx is done.
+func (m *machine) Stop(ctx context.Context) error {
+	return m.StopWithOptions(ctx, StopOptions{})
+}
+
+// StopWithOptions gracefully stops the machine by pressing the ACPI power
+// button until the guest powers off, falling back to opts.Fallback if that
+// takes longer than opts.Timeout. The machine counts as stopped in any
+// offline state, e.g. also when it aborted.
+func (m *machine) StopWithOptions(ctx context.Context, opts StopOptions) error {
+	switch t, err := m.transition(OpStop); t {
+	case illegal, noop:
+		return err
+	case startFirst:
+		if err := m.resume(ctx); err != nil {
 			return err
 		}
 	}
 
-	for m.state != Poweroff { // busy wait until the machine is stopped
-		if err := vbm("controlvm", m.name, "acpipowerbutton"); err != nil {
-			return err
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = m.client.pollInterval()
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	var expired <-chan time.Time
+	if opts.Timeout > 0 {
+		t := time.NewTimer(opts.Timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+
+	// Poll until the machine is stopped. A machine that is already shutting
+	// down or busy does not accept the power button, so it is only pressed
+	// in stable states.
+	for m.state.IsOnline() {
+		if !m.state.IsTransient() {
+			if err := m.client.vbm(ctx, "controlvm", m.name, "acpipowerbutton"); err != nil {
+				return err
+			}
 		}
-		time.Sleep(1 * time.Second)
-		if err := m.Refresh(); err != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-expired:
+			return m.stopFallback(ctx, opts)
+		case <-tick.C:
+		}
+		if err := m.Refresh(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
-func (m *machine) Poweroff() error {
-	switch m.state {
-	case Poweroff, Aborted, Saved:
+// stopFallback handles an expired grace period of StopWithOptions.
+func (m *machine) stopFallback(ctx context.Context, opts StopOptions) error {
+	if err := m.Refresh(ctx); err != nil {
+		return err
+	}
+	if !m.state.IsOnline() {
 		return nil
 	}
-	return vbm("controlvm", m.name, "poweroff")
+	switch opts.Fallback {
+	case StopFallbackPoweroff:
+		if err := m.Poweroff(ctx); err != nil {
+			return err
+		}
+	case StopFallbackSave:
+		if err := m.Save(ctx); err != nil {
+			return err
+		}
+	default:
+		return &StopTimeoutError{Machine: m.name, Timeout: opts.Timeout, State: m.state}
+	}
+	return m.Refresh(ctx)
+}
+
+// WaitForState blocks until the machine is in one of the given states or ctx
+// is done. The state is polled at the client's PollInterval.
+func (m *machine) WaitForState(ctx context.Context, states ...MachineState) error {
+	tick := time.NewTicker(m.client.pollInterval())
+	defer tick.Stop()
+	for {
+		if err := m.Refresh(ctx); err != nil {
+			return err
+		}
+		for _, s := range states {
+			if m.state == s {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for machine %s to be %v (state %s): %w", m.name, states, m.state, ctx.Err())
+		case <-tick.C:
+		}
+	}
+}
+
+// Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
+func (m *machine) Poweroff(ctx context.Context) error {
+	if t, err := m.transition(OpPoweroff); t != direct {
+		return err
+	}
+	return m.client.vbm(ctx, "controlvm", m.name, "poweroff")
 }
 
 // Restart gracefully restarts the machine.
-func (m *machine) Restart() error {
-	switch m.state {
-	case Paused, Saved:
-		if err := m.Start(); err != nil {
+func (m *machine) Restart(ctx context.Context) error {
+	switch t, err := m.transition(OpRestart); t {
+	case illegal:
+		return err
+	case startFirst:
+		if err := m.resume(ctx); err != nil {
 			return err
 		}
 	}
-	if err := m.Stop(); err != nil {
+	if err := m.Stop(ctx); err != nil {
 		return err
 	}
-	return m.Start()
+	return m.Start(ctx)
 }
 
 // Reset forcefully restarts the machine. State is lost and might corrupt the disk image.
-func (m *machine) Reset() error {
-	switch m.state {
-	case Paused, Saved:
-		if err := m.Start(); err != nil {
+func (m *machine) Reset(ctx context.Context) error {
+	switch t, err := m.transition(OpReset); t {
+	case illegal:
+		return err
+	case startFirst:
+		if err := m.resume(ctx); err != nil {
 			return err
 		}
 	}
-	return vbm("controlvm", m.name, "reset")
+	return m.client.vbm(ctx, "controlvm", m.name, "reset")
 }
 
 // Delete deletes the machine and associated disk images.
-func (m *machine) Delete() error {
-	if err := m.Poweroff(); err != nil {
+func (m *machine) Delete(ctx context.Context) error {
+	if err := m.Poweroff(ctx); err != nil {
 		return err
 	}
-	return vbm("unregistervm", m.name, "--delete")
+	return m.client.vbm(ctx, "unregistervm", m.name, "--delete")
 }
 
-// GetMachine finds a machine by its name or UUID.
-func getMachine(id string) (*machine, error) {
-	stdout, stderr, err := vbmOutErr("showvminfo", id, "--machinereadable")
+// GetMachine finds a machine by its name or UUID. If there is no such machine,
+// errors.Is(err, ErrMachineNotExist) holds for the returned error.
+func (c *Client) getMachine(ctx context.Context, id string) (*machine, error) {
+	stdout, err := c.vbmOut(ctx, "showvminfo", id, "--machinereadable")
 	if err != nil {
-		if reMachineNotFound.FindString(stderr) != "" {
-			return nil, ErrMachineNotExist
-		}
 		return nil, err
 	}
-	s := bufio.NewScanner(strings.NewReader(stdout))
-	m := &machine{}
-	for s.Scan() {
-		res := reVMInfoLine.FindStringSubmatch(s.Text())
-		if res == nil {
-			continue
-		}
-		key := res[1]
-		if key == "" {
-			key = res[2]
-		}
-		val := res[3]
-		if val == "" {
-			val = res[4]
-		}
-
-		switch key {
-		case "name":
-			m.name = val
-		case "UUID":
-			m.uUID = val
-		case "VMState":
-			m.state = MachineState(val)
-		case "memory":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.memory = uint(n)
-		case "cpus":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.cPUs = uint(n)
-		case "vram":
-			n, err := strconv.ParseUint(val, 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			m.vRAM = uint(n)
-		case "CfgFile":
-			m.cfgFile = val
-			m.baseFolder = filepath.Dir(val)
-		}
-	}
-	if err := s.Err(); err != nil {
+	info, err := parseMachineInfo(stdout)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return &machine{
+		client:     c,
+		name:       info.Name,
+		uUID:       info.UUID,
+		state:      info.State,
+		cPUs:       info.CPUs,
+		memory:     info.Memory,
+		vRAM:       info.VRAM,
+		cfgFile:    info.CfgFile,
+		baseFolder: info.BaseFolder,
+		oSType:     info.OSType,
+		flag:       info.Flag,
+		bootOrder:  info.BootOrder,
+		info:       info,
+	}, nil
 }
 
 // ListMachines lists all registered machines.
-func listMachines() ([]*machine, error) {
-	out, err := vbmOut("list", "vms")
+func (c *Client) listMachines(ctx context.Context) ([]*machine, error) {
+	out, err := c.vbmOut(ctx, "list", "vms")
 	if err != nil {
 		return nil, err
 	}
@@ -254,7 +368,7 @@ func listMachines() ([]*machine, error) {
 		if res == nil {
 			continue
 		}
-		m, err := getMachine(res[1])
+		m, err := c.getMachine(ctx, res[1])
 		if err != nil {
 			return nil, err
 		}
@@ -267,13 +381,13 @@ func listMachines() ([]*machine, error) {
 }
 
 // CreateMachine creates a new machine. If basefolder is empty, use default.
-func createMachine(name, basefolder string) (*machine, error) {
+func (c *Client) createMachine(ctx context.Context, name, basefolder string) (*machine, error) {
 	if name == "" {
 		return nil, fmt.Errorf("machine name is empty")
 	}
 
 	// Check if a machine with the given name already exists.
-	ms, err := listMachines()
+	ms, err := c.listMachines(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -288,11 +402,11 @@ func createMachine(name, basefolder string) (*machine, error) {
 	if basefolder != "" {
 		args = append(args, "--basefolder", basefolder)
 	}
-	if err := vbm(args...); err != nil {
+	if err := c.vbm(ctx, args...); err != nil {
 		return nil, err
 	}
 
-	m, err := getMachine(name)
+	m, err := c.getMachine(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -300,76 +414,127 @@ func createMachine(name, basefolder string) (*machine, error) {
 	return m, nil
 }
 
-// Modify changes the settings of the machine.
-func (m *machine) Modify() error {
-	args := []string{"modifyvm", m.name,
-		"--firmware", "bios",
-		"--bioslogofadein", "off",
-		"--bioslogofadeout", "off",
-		"--bioslogodisplaytime", "0",
-		"--biosbootmenu", "disabled",
-
-		"--ostype", m.oSType,
-		"--cpus", fmt.Sprintf("%d", m.cPUs),
-		"--memory", fmt.Sprintf("%d", m.memory),
-		"--vram", fmt.Sprintf("%d", m.vRAM),
-
-		"--acpi", m.flag.Get(F_acpi),
-		"--ioapic", m.flag.Get(F_ioapic),
-		"--rtcuseutc", m.flag.Get(F_rtcuseutc),
-		"--cpuhotplug", m.flag.Get(F_cpuhotplug),
-		"--pae", m.flag.Get(F_pae),
-		"--longmode", m.flag.Get(F_longmode),
-		"--synthcpu", m.flag.Get(F_synthcpu),
-		"--hpet", m.flag.Get(F_hpet),
-		"--hwvirtex", m.flag.Get(F_hwvirtex),
-		"--triplefaultreset", m.flag.Get(F_triplefaultreset),
-		"--nestedpaging", m.flag.Get(F_nestedpaging),
-		"--largepages", m.flag.Get(F_largepages),
-		"--vtxvpid", m.flag.Get(F_vtxvpid),
-		"--vtxux", m.flag.Get(F_vtxux),
-		"--accelerate3d", m.flag.Get(F_accelerate3d),
+// Modify changes the settings of the machine. Only settings that differ from
+// the state loaded by the last refresh are sent to VirtualBox.
+func (m *machine) Modify(ctx context.Context) error {
+	args := m.modifyArgs()
+	if len(args) == 0 {
+		return nil
+	}
+	if err := m.client.vbm(ctx, append([]string{"modifyvm", m.id()}, args...)...); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// id returns the most stable identifier of the machine as VirtualBox knows it.
+func (m *machine) id() string {
+	if m.uUID != "" {
+		return m.uUID
+	}
+	if old := m.Info(); old.Name != "" {
+		return old.Name
 	}
+	return m.name
+}
 
+// modifyArgs returns the modifyvm options for the settings changed since the
+// last refresh.
+func (m *machine) modifyArgs() []string {
+	old := m.Info()
+	var args []string
+	if m.name != old.Name {
+		args = append(args, "--name", m.name)
+	}
+	if m.oSType != old.OSType {
+		args = append(args, "--ostype", m.oSType)
+	}
+	if m.cPUs != old.CPUs {
+		args = append(args, "--cpus", fmt.Sprintf("%d", m.cPUs))
+	}
+	if m.memory != old.Memory {
+		args = append(args, "--memory", fmt.Sprintf("%d", m.memory))
+	}
+	if m.vRAM != old.VRAM {
+		args = append(args, "--vram", fmt.Sprintf("%d", m.vRAM))
+	}
+	for _, f := range flagNames {
+		if m.flag&f.flag != old.Flag&f.flag {
+			args = append(args, "--"+f.name, m.flag.Get(f.flag))
+		}
+	}
 	for i, dev := range m.bootOrder {
 		if i > 3 {
 			break // Only four slots `--boot{1,2,3,4}`. Ignore the rest.
 		}
+		if i < len(old.BootOrder) && old.BootOrder[i] == dev {
+			continue
+		}
 		args = append(args, fmt.Sprintf("--boot%d", i+1), dev)
 	}
-	if err := vbm(args...); err != nil {
-		return err
+	// Clear the slots a shorter boot order no longer uses.
+	for i := len(m.bootOrder); i < len(old.BootOrder) && i < 4; i++ {
+		if old.BootOrder[i] != "none" {
+			args = append(args, fmt.Sprintf("--boot%d", i+1), "none")
+		}
 	}
-	return m.Refresh()
+	return args
 }
 
 // AddNATPF adds a NAT port forarding rule to the n-th NIC with the given name.
-func (m *machine) AddNATPF(n int, name string, rule PFRule) error {
-	return vbm("controlvm", m.name, fmt.Sprintf("natpf%d", n),
+func (m *machine) AddNATPF(ctx context.Context, n int, name string, rule PFRule) error {
+	return m.client.vbm(ctx, "controlvm", m.name, fmt.Sprintf("natpf%d", n),
 		fmt.Sprintf("%s,%s", name, rule.Format()))
 }
 
 // DelNATPF deletes the NAT port forwarding rule with the given name from the n-th NIC.
-func (m *machine) DelNATPF(n int, name string) error {
-	return vbm("controlvm", m.name, fmt.Sprintf("natpf%d", n), "delete", name)
+func (m *machine) DelNATPF(ctx context.Context, n int, name string) error {
+	return m.client.vbm(ctx, "controlvm", m.name, fmt.Sprintf("natpf%d", n), "delete", name)
 }
 
-// SetNIC set the n-th NIC.
-func (m *machine) SetNIC(n int, nic NIC) error {
+// SetNIC set the n-th NIC. Attaching it to a host-only network of
+// VirtualBox 7 fails with ErrHostonlyNetworkUnsupported on older versions.
+func (m *machine) SetNIC(ctx context.Context, n int, nic NIC) error {
+	if nic.Network == NICNetHostonlyNet {
+		if err := m.client.checkHostonlyNetworks(ctx); err != nil {
+			return err
+		}
+	}
 	args := []string{"modifyvm", m.name,
 		fmt.Sprintf("--nic%d", n), string(nic.Network),
 		fmt.Sprintf("--nictype%d", n), string(nic.Hardware),
 		fmt.Sprintf("--cableconnected%d", n), "on",
 	}
 
-	if nic.Network == "hostonly" {
+	switch nic.Network {
+	case NICNetHostonly:
 		args = append(args, fmt.Sprintf("--hostonlyadapter%d", n), nic.HostonlyAdapter)
+	case NICNetHostonlyNet:
+		args = append(args, fmt.Sprintf("--host-only-net%d", n), nic.HostonlyNetwork)
+	case NICNetBridged:
+		if nic.BridgeAdapter != "" {
+			args = append(args, fmt.Sprintf("--bridgeadapter%d", n), nic.BridgeAdapter)
+		}
+	case NICNetInternal:
+		if nic.InternalNetwork != "" {
+			args = append(args, fmt.Sprintf("--intnet%d", n), nic.InternalNetwork)
+		}
+	case NICNetNATNetwork:
+		args = append(args, fmt.Sprintf("--nat-network%d", n), nic.NATNetwork)
+	}
+	if nic.MACAddress != "" {
+		args = append(args, fmt.Sprintf("--macaddress%d", n), nic.MACAddress)
 	}
-	return vbm(args...)
+	return m.client.vbm(ctx, args...)
 }
 
-// AddStorageCtl adds a storage controller with the given name.
-func (m *machine) AddStorageCtl(name string, ctl StorageController) error {
+// AddStorageCtl adds a storage controller with the given name. It returns
+// ErrInvalidStorageCtl without running VBoxManage if the chipset does not
+// sit on the bus or the bus does not have that many ports.
+func (m *machine) AddStorageCtl(ctx context.Context, name string, ctl StorageController) error {
+	if err := ctl.validate(); err != nil {
+		return fmt.Errorf("storagectl %s: %w", name, err)
+	}
 	args := []string{"storagectl", m.name, "--name", name}
 	if ctl.SysBus != "" {
 		args = append(args, "--add", string(ctl.SysBus))
@@ -382,22 +547,27 @@ func (m *machine) AddStorageCtl(name string, ctl StorageController) error {
 	}
 	args = append(args, "--hostiocache", bool2string(ctl.HostIOCache))
 	args = append(args, "--bootable", bool2string(ctl.Bootable))
-	return vbm(args...)
+	return m.client.vbm(ctx, args...)
 }
 
 // DelStorageCtl deletes the storage controller with the given name.
-func (m *machine) DelStorageCtl(name string) error {
-	return vbm("storagectl", m.name, "--name", name, "--remove")
+func (m *machine) DelStorageCtl(ctx context.Context, name string) error {
+	return m.client.vbm(ctx, "storagectl", m.name, "--name", name, "--remove")
 }
 
 // AttachStorage attaches a storage medium to the named storage controller.
-func (m *machine) AttachStorage(ctlName string, medium StorageMedium) error {
-	return vbm("storageattach", m.name, "--storagectl", ctlName,
-		"--port", fmt.Sprintf("%d", medium.Port),
-		"--device", fmt.Sprintf("%d", medium.Device),
-		"--type", string(medium.DriveType),
-		"--medium", medium.Medium,
-	)
+// On a running machine it changes the medium of an existing DVD or floppy
+// drive, which swaps the disc seen by the guest; set ForceUnmount if the
+// guest has locked the drive.
+func (m *machine) AttachStorage(ctx context.Context, ctlName string, medium StorageMedium) error {
+	args := append([]string{"storageattach", m.name, "--storagectl", ctlName}, medium.args()...)
+	return m.client.vbm(ctx, args...)
+}
+
+// DetachStorage removes the drive at the given port and device of the named
+// storage controller, along with its medium.
+func (m *machine) DetachStorage(ctx context.Context, ctlName string, port, device uint) error {
+	return m.AttachStorage(ctx, ctlName, StorageMedium{Port: port, Device: device, Medium: "none"})
 }
 
 func (m *machine) Name() string {
@@ -444,6 +614,26 @@ func (m *machine) BootOrder() []string {
 	return m.bootOrder
 }
 
+// StorageControllers returns the storage controllers of the machine, keyed by
+// name, as of the last refresh.
+func (m *machine) StorageControllers() map[string]StorageController {
+	return m.Info().StorageControllers
+}
+
+// Attachments returns the media attached to the storage controllers of the
+// machine as of the last refresh.
+func (m *machine) Attachments() []StorageAttachment {
+	return m.Info().Attachments
+}
+
+// Info returns the full configuration of the machine as of the last refresh.
+func (m *machine) Info() *MachineInfo {
+	if m.info == nil {
+		return &MachineInfo{}
+	}
+	return m.info
+}
+
 func (m *machine) SetName(name string) {
 	m.name = name
 }
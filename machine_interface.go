@@ -1,22 +1,33 @@
 package virtualbox
 
+import "context"
+
 type Machine interface {
-	Refresh() error
-	Start() error
-	Save() error
-	Pause() error
-	Stop() error
-	Poweroff() error
-	Restart() error
-	Reset() error
-	Delete() error
-	Modify() error
-	AddNATPF(n int, name string, rule PFRule) error
-	DelNATPF(n int, name string) error
-	SetNIC(n int, nic NIC) error
-	AddStorageCtl(name string, ctl StorageController) error
-	DelStorageCtl(name string) error
-	AttachStorage(ctlName string, medium StorageMedium) error
+	Refresh(ctx context.Context) error
+	Start(ctx context.Context) error
+	Save(ctx context.Context) error
+	Pause(ctx context.Context) error
+	Stop(ctx context.Context) error
+	StopWithOptions(ctx context.Context, opts StopOptions) error
+	Poweroff(ctx context.Context) error
+	Restart(ctx context.Context) error
+	WaitForState(ctx context.Context, states ...MachineState) error
+	Reset(ctx context.Context) error
+	Delete(ctx context.Context) error
+	Modify(ctx context.Context) error
+	AddNATPF(ctx context.Context, n int, name string, rule PFRule) error
+	DelNATPF(ctx context.Context, n int, name string) error
+	SetNIC(ctx context.Context, n int, nic NIC) error
+	AddStorageCtl(ctx context.Context, name string, ctl StorageController) error
+	DelStorageCtl(ctx context.Context, name string) error
+	AttachStorage(ctx context.Context, ctlName string, medium StorageMedium) error
+	DetachStorage(ctx context.Context, ctlName string, port, device uint) error
+	TakeSnapshot(ctx context.Context, name, description string, live bool) error
+	RestoreSnapshot(ctx context.Context, id string) error
+	RestoreCurrent(ctx context.Context) error
+	DeleteSnapshot(ctx context.Context, id string) error
+	EditSnapshot(ctx context.Context, id, name, description string) error
+	ListSnapshots(ctx context.Context) (*Snapshot, error)
 
 	// Getters and Setters
 	Name() string
@@ -30,6 +41,9 @@ type Machine interface {
 	OSType() string
 	Flag() Flag
 	BootOrder() []string
+	StorageControllers() map[string]StorageController
+	Attachments() []StorageAttachment
+	Info() *MachineInfo
 
 	SetName(string)
 	SetUUID(string)
@@ -45,9 +59,24 @@ type Machine interface {
 }
 
 // ListMachines lists all registered machines.
-func ListMachines() ([]*Machine, error) {
+func ListMachines(ctx context.Context) ([]*Machine, error) {
+	return DefaultClient.ListMachines(ctx)
+}
+
+// GetMachine finds a machine by its name or UUID.
+func GetMachines(ctx context.Context, id string) (*Machine, error) {
+	return DefaultClient.GetMachines(ctx, id)
+}
+
+// CreateMachine creates a new machine. If basefolder is empty, use default.
+func CreateMachine(ctx context.Context, name, basefolder string) (*Machine, error) {
+	return DefaultClient.CreateMachine(ctx, name, basefolder)
+}
+
+// ListMachines lists all registered machines.
+func (c *Client) ListMachines(ctx context.Context) ([]*Machine, error) {
 	var mi []*Machine
-	machines, err := listMachines()
+	machines, err := c.listMachines(ctx)
 	if err != nil {
 		return mi, err
 	}
@@ -59,8 +88,8 @@ func ListMachines() ([]*Machine, error) {
 }
 
 // GetMachine finds a machine by its name or UUID.
-func GetMachines(id string) (*Machine, error) {
-	m, err := getMachine(id)
+func (c *Client) GetMachines(ctx context.Context, id string) (*Machine, error) {
+	m, err := c.getMachine(ctx, id)
 	if err != nil {
 		var x Machine
 		return &x, err
@@ -70,8 +99,8 @@ func GetMachines(id string) (*Machine, error) {
 }
 
 // CreateMachine creates a new machine. If basefolder is empty, use default.
-func CreateMachine(name, basefolder string) (*Machine, error) {
-	m, err := createMachine(name, basefolder)
+func (c *Client) CreateMachine(ctx context.Context, name, basefolder string) (*Machine, error) {
+	m, err := c.createMachine(ctx, name, basefolder)
 	if err != nil {
 		var x Machine
 		return &x, err
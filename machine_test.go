@@ -1,12 +1,20 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
 
 // compile time check to make sure machine type implements Machine interface
 var _  Machine = (*machine)(nil)
 
 func TestMachine(t *testing.T) {
-	ms, err := listMachines()
+	ms, err := DefaultClient.listMachines(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -14,3 +22,208 @@ func TestMachine(t *testing.T) {
 		t.Logf("%+v", m)
 	}
 }
+
+func TestModifyOnlyChanged(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo builder --machinereadable"] = readFixture(t, "showvminfo.txt")
+	f.stdout["showvminfo c0d3a2b4-1f2e-4a5b-9c8d-7e6f5a4b3c2d --machinereadable"] = readFixture(t, "showvminfo.txt")
+	ctx := context.Background()
+	m, err := f.client().getMachine(ctx, "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing changed: no command at all.
+	if err := m.Modify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 1 {
+		t.Fatalf("unexpected commands %q", f.calls[1:])
+	}
+
+	m.SetMemory(4096)
+	m.SetFlag(m.Flag() &^ F_ioapic)
+	m.SetBootOrder([]string{"disk", "net"})
+	if err := m.Modify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"modifyvm", "c0d3a2b4-1f2e-4a5b-9c8d-7e6f5a4b3c2d",
+		"--memory", "4096", "--ioapic", "off", "--boot2", "net"}
+	if got := f.calls[1]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A shorter boot order clears the slots it no longer uses. The refreshed
+	// machine boots disk, dvd again.
+	m.SetBootOrder([]string{"disk"})
+	if err := m.Modify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"modifyvm", "c0d3a2b4-1f2e-4a5b-9c8d-7e6f5a4b3c2d", "--boot2", "none"}
+	if got := f.calls[3]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo builder --machinereadable"] = readFixture(t, "showvminfo.txt")
+	ctx := context.Background()
+	m, err := f.client().getMachine(ctx, "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := StopOptions{Timeout: 30 * time.Millisecond, Interval: 5 * time.Millisecond}
+	err = m.StopWithOptions(ctx, opts)
+	var te *StopTimeoutError
+	if !errors.As(err, &te) || te.State != Running {
+		t.Fatalf("got %v, want *StopTimeoutError", err)
+	}
+
+	f.calls = nil
+	opts.Fallback = StopFallbackPoweroff
+	if err := m.StopWithOptions(ctx, opts); err != nil {
+		t.Fatal(err)
+	}
+	var poweroff bool
+	for _, c := range f.calls {
+		poweroff = poweroff || reflect.DeepEqual(c, []string{"controlvm", "builder", "poweroff"})
+	}
+	if !poweroff {
+		t.Fatalf("fallback did not power off, commands %q", f.calls)
+	}
+}
+
+func TestStopStates(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		states []MachineState // reported by successive showvminfo calls
+		button int            // expected power button presses
+	}{
+		{"stopping", []MachineState{Running, Stopping, Stopping, Poweroff}, 1},
+		{"already stopping", []MachineState{Stopping, Poweroff}, 0},
+		{"aborted", []MachineState{Running, Running, Aborted}, 2},
+	} {
+		f := newFakeVBM()
+		fixture := readFixture(t, "showvminfo.txt")
+		states := tc.states
+		exec := ExecFunc(func(ctx context.Context, cmd *Command) error {
+			if cmd.Args[0] == "showvminfo" && len(states) > 0 {
+				f.stdout["showvminfo builder --machinereadable"] = strings.Replace(fixture,
+					`VMState="running"`, fmt.Sprintf("VMState=%q", states[0]), 1)
+				states = states[1:]
+			}
+			return f.Exec(ctx, cmd)
+		})
+		ctx := context.Background()
+		m, err := (&Client{Executor: exec}).getMachine(ctx, "builder")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.StopWithOptions(ctx, StopOptions{Interval: time.Millisecond}); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		var button int
+		for _, c := range f.calls {
+			if reflect.DeepEqual(c, []string{"controlvm", "builder", "acpipowerbutton"}) {
+				button++
+			}
+		}
+		if button != tc.button || len(states) != 0 {
+			t.Errorf("%s: pressed the power button %d times, want %d; %d states left", tc.name, button, tc.button, len(states))
+		}
+	}
+}
+
+func TestStorageAttachments(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo builder --machinereadable"] = readFixture(t, "showvminfo.txt")
+	ctx := context.Background()
+	m, err := f.client().getMachine(ctx, "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctl := m.StorageControllers()["SATA-Main"]; ctl.Chipset != CtrlIntelAHCI || ctl.Ports != 4 {
+		t.Errorf("got SATA-Main controller %+v", ctl)
+	}
+	if atts := m.Attachments(); len(atts) != 2 || atts[0].DriveType != DriveDVD {
+		t.Errorf("got attachments %+v", atts)
+	}
+
+	// Swap the DVD of the running machine.
+	err = m.AttachStorage(ctx, "IDE", StorageMedium{Port: 1, Device: 0, DriveType: DriveDVD,
+		Medium: "/home/ci/iso/tools.iso", TempEject: Bool(true), ForceUnmount: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"storageattach", "builder", "--storagectl", "IDE", "--port", "1", "--device", "0",
+		"--type", "dvddrive", "--medium", "/home/ci/iso/tools.iso", "--tempeject", "on", "--forceunmount"}
+	if got := f.calls[1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	err = m.AttachStorage(ctx, "SATA-Main", StorageMedium{Port: 1, DriveType: DriveHDD, Medium: "data.vdi",
+		MType: MediumWritethrough, Hotpluggable: Bool(false), NonRotational: Bool(true), Discard: Bool(true)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"storageattach", "builder", "--storagectl", "SATA-Main", "--port", "1", "--device", "0",
+		"--type", "hdd", "--medium", "data.vdi", "--mtype", "writethrough",
+		"--hotpluggable", "off", "--nonrotational", "on", "--discard", "on"}
+	if got := f.calls[2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := m.DetachStorage(ctx, "SATA-Main", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"storageattach", "builder", "--storagectl", "SATA-Main", "--port", "1", "--device", "0", "--medium", "none"}
+	if got := f.calls[3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAddStorageCtl(t *testing.T) {
+	f := newFakeVBM()
+	m := &machine{client: f.client(), name: "perf"}
+	ctx := context.Background()
+	if err := m.AddStorageCtl(ctx, "NVMe", StorageController{SysBus: SysBusPCIe, Chipset: CtrlNVMe, Ports: 4}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"storagectl", "perf", "--name", "NVMe", "--add", "pcie", "--portcount", "4",
+		"--controller", "NVMe", "--hostiocache", "off", "--bootable", "off"}
+	if len(f.calls) != 1 || !reflect.DeepEqual(f.calls[0], want) {
+		t.Fatalf("got %q, want %q", f.calls, [][]string{want})
+	}
+
+	for _, ctl := range []StorageController{
+		{SysBus: SysBusSATA, Chipset: CtrlNVMe},
+		{SysBus: SysBusVirtio, Chipset: CtrlLSILogic},
+		{SysBus: SysBusSATA, Ports: 31},
+		{Chipset: CtrlUSB, Ports: 9},
+		{SysBus: SystemBus("pci")},
+	} {
+		if err := m.AddStorageCtl(ctx, "bad", ctl); !errors.Is(err, ErrInvalidStorageCtl) {
+			t.Errorf("%+v: got %v, want ErrInvalidStorageCtl", ctl, err)
+		}
+	}
+	if len(f.calls) != 1 {
+		t.Errorf("invalid controllers ran %q", f.calls[1:])
+	}
+}
+
+func TestParseChipset(t *testing.T) {
+	for s, want := range map[string]StorageControllerChipset{
+		"IntelAhci":   CtrlIntelAHCI,
+		"LsiLogicSas": CtrlLSILogicSAS,
+		"NVMe":        CtrlNVMe,
+		"VirtioSCSI":  CtrlVirtIO,
+		"USB":         CtrlUSB,
+	} {
+		if got := parseChipset(s); got != want {
+			t.Errorf("parseChipset(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package virtualbox
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reIndexedKey   = regexp.MustCompile(`^([A-Za-z-]+?)(\d+)$`)
+	reForwarding   = regexp.MustCompile(`^Forwarding\((\d+)\)$`)
+	reSharedFolder = regexp.MustCompile(`^SharedFolder(Name|Path)(Machine|Transient)Mapping(\d+)$`)
+	reAttachment   = regexp.MustCompile(`^(?:(.+)-)?(\d+)-(\d+)$`)
+)
+
+// MachineInfo is the configuration of a machine as reported by
+// `VBoxManage showvminfo --machinereadable`.
+type MachineInfo struct {
+	Name               string
+	UUID               string
+	Groups             []string
+	Description        string
+	OSType             string
+	State              MachineState
+	StateChangeTime    time.Time
+	CfgFile            string
+	BaseFolder         string
+	SnapshotFolder     string
+	LogFolder          string
+	HardwareUUID       string
+	CPUs               uint
+	CPUExecutionCap    uint // percentage 1--100
+	Memory             uint // main memory (in MB)
+	VRAM               uint // video memory (in MB)
+	Chipset            string
+	Firmware           string // BIOS|EFI|EFI32|EFI64
+	ParavirtProvider   string
+	GraphicsController string
+	Flag               Flag
+	BootOrder          []string // max 4 slots, each in {none|floppy|dvd|disk|net}
+	BootMenu           string   // disabled|menuonly|messageandmenu
+
+	NICs               map[int]NIC                  // keyed by NIC slot, starting at 1
+	PortForwards       map[int]map[string]PFRule    // keyed by NIC slot, then rule name
+	StorageControllers map[string]StorageController // keyed by controller name
+	Attachments        []StorageAttachment
+	SharedFolders      []SharedFolder
+	Snapshot           *Snapshot // root of the snapshot tree, nil if there are none
+
+	Raw map[string]string // every key reported by VBoxManage
+}
+
+// StorageAttachment is a medium attached to a port of a storage controller.
+type StorageAttachment struct {
+	Controller string // name of the storage controller
+	StorageMedium
+	UUID string // UUID of the attached image, if any
+}
+
+// SharedFolder is a host directory shared with the guest.
+type SharedFolder struct {
+	Name      string
+	HostPath  string
+	Transient bool // only exists while the machine is running
+}
+
+// keyValue is a single `key=value` line of machine-readable output.
+type keyValue struct {
+	key, val string
+}
+
+// parseMachineReadable splits the output of a --machinereadable command into
+// its key/value pairs, in order. Quoted values may span several lines.
+func parseMachineReadable(out string) []keyValue {
+	var kvs []keyValue
+	lines := strings.Split(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		eq := keyEnd(line)
+		if eq < 0 {
+			continue
+		}
+		key, val := line[:eq], line[eq+1:]
+		if strings.HasPrefix(val, `"`) {
+			// Accumulate continuation lines until the closing quote.
+			for !closedQuote(val) && i+1 < len(lines) {
+				i++
+				val += "\n" + lines[i]
+			}
+		}
+		kvs = append(kvs, keyValue{key, val})
+	}
+	escaped := true
+	for _, kv := range kvs {
+		if !isEscaped(kv.key) || !isEscaped(kv.val) {
+			escaped = false
+			break
+		}
+	}
+	for i := range kvs {
+		kvs[i].key = unquote(kvs[i].key, escaped)
+		kvs[i].val = unquote(kvs[i].val, escaped)
+	}
+	return kvs
+}
+
+// isEscaped reports whether every backslash in s starts an escape sequence
+// of VirtualBox 6.1 and later. Older versions print backslashes as they are,
+// e.g. in Windows paths such as C:\VMs\vm.vdi.
+func isEscaped(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		if i+1 == len(s) || !strings.ContainsRune(`n"\`, rune(s[i+1])) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// keyEnd returns the index of the '=' separating key and value, or -1.
+func keyEnd(line string) int {
+	if !strings.HasPrefix(line, `"`) {
+		return strings.Index(line, "=")
+	}
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			if i+1 < len(line) && line[i+1] == '=' {
+				return i + 1
+			}
+			return -1
+		}
+	}
+	return -1
+}
+
+// closedQuote reports whether the quoted string s ends with an unescaped quote.
+func closedQuote(s string) bool {
+	if len(s) < 2 || !strings.HasSuffix(s, `"`) {
+		return false
+	}
+	n := 0 // backslashes before the final quote
+	for i := len(s) - 2; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 0
+}
+
+// unquote strips surrounding quotes and, if escaped is set, undoes the
+// escaping VirtualBox 6.1 and later apply to machine-readable strings.
+func unquote(s string, escaped bool) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if !escaped || !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+				continue
+			case '"', '\\':
+				b.WriteByte(s[i])
+				continue
+			}
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseUint(key, val string) (uint, error) {
+	n, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("showvminfo: %s: %v", key, err)
+	}
+	return uint(n), nil
+}
+
+// parseMachineInfo parses the output of `showvminfo --machinereadable`.
+func parseMachineInfo(out string) (*MachineInfo, error) {
+	info := &MachineInfo{
+		NICs:               map[int]NIC{},
+		PortForwards:       map[int]map[string]PFRule{},
+		StorageControllers: map[string]StorageController{},
+		Raw:                map[string]string{},
+	}
+	var (
+		ctlNames []string                       // storage controllers by index
+		ctls     = map[int]*StorageController{} // storage controllers by index
+		boot     = map[int]string{}
+		folders  = map[string]*SharedFolder{} // shared folders by kind and index
+		order    []string                     // shared folder keys as they appear
+		lastNIC  int
+	)
+	kvs := parseMachineReadable(out)
+	for _, kv := range kvs {
+		key, val := kv.key, kv.val
+		info.Raw[key] = val
+
+		switch key {
+		case "name":
+			info.Name = val
+			continue
+		case "UUID":
+			info.UUID = val
+			continue
+		case "groups":
+			info.Groups = strings.Split(val, ",")
+			continue
+		case "description":
+			info.Description = val
+			continue
+		case "ostype":
+			info.OSType = val
+			continue
+		case "VMState":
+			info.State = MachineState(val)
+			continue
+		case "VMStateChangeTime":
+			if t, err := time.Parse("2006-01-02T15:04:05.999999999", val); err == nil {
+				info.StateChangeTime = t
+			}
+			continue
+		case "CfgFile":
+			info.CfgFile = val
+			info.BaseFolder = filepath.Dir(val)
+			continue
+		case "SnapFldr":
+			info.SnapshotFolder = val
+			continue
+		case "LogFldr":
+			info.LogFolder = val
+			continue
+		case "hardwareuuid":
+			info.HardwareUUID = val
+			continue
+		case "memory", "cpus", "vram", "cpuexecutioncap":
+			n, err := parseUint(key, val)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "memory":
+				info.Memory = n
+			case "cpus":
+				info.CPUs = n
+			case "vram":
+				info.VRAM = n
+			case "cpuexecutioncap":
+				info.CPUExecutionCap = n
+			}
+			continue
+		case "chipset":
+			info.Chipset = val
+			continue
+		case "firmware":
+			info.Firmware = val
+			continue
+		case "paravirtprovider":
+			info.ParavirtProvider = val
+			continue
+		case "graphicscontroller":
+			info.GraphicsController = val
+			continue
+		case "bootmenu":
+			info.BootMenu = val
+			continue
+		}
+
+		if f, ok := flagByName[key]; ok {
+			if val == "on" {
+				info.Flag |= f
+			}
+			continue
+		}
+
+		if res := reForwarding.FindStringSubmatch(key); res != nil {
+			name, rule, err := parsePFRule(val)
+			if err != nil {
+				return nil, err
+			}
+			if info.PortForwards[lastNIC] == nil {
+				info.PortForwards[lastNIC] = map[string]PFRule{}
+			}
+			info.PortForwards[lastNIC][name] = rule
+			continue
+		}
+
+		if res := reSharedFolder.FindStringSubmatch(key); res != nil {
+			id := res[2] + res[3]
+			sf := folders[id]
+			if sf == nil {
+				sf = &SharedFolder{Transient: res[2] == "Transient"}
+				folders[id] = sf
+				order = append(order, id)
+			}
+			if res[1] == "Name" {
+				sf.Name = val
+			} else {
+				sf.HostPath = val
+			}
+			continue
+		}
+
+		if res := reIndexedKey.FindStringSubmatch(key); res != nil {
+			i, _ := strconv.Atoi(res[2])
+			switch res[1] {
+			case "boot":
+				boot[i] = val
+				continue
+			case "nic", "nictype", "macaddress", "hostonlyadapter", "hostonly-network", "bridgeadapter", "intnet", "nat-network", "natnet", "cableconnected":
+				lastNIC = i
+				nic := info.NICs[i]
+				switch res[1] {
+				case "nic":
+					nic.Network = NICNetwork(val)
+				case "nictype":
+					nic.Hardware = NICHardware(val)
+				case "macaddress":
+					nic.MACAddress = val
+				case "hostonlyadapter":
+					nic.HostonlyAdapter = val
+				case "hostonly-network":
+					nic.HostonlyNetwork = val
+				case "bridgeadapter":
+					nic.BridgeAdapter = val
+				case "intnet":
+					nic.InternalNetwork = val
+				case "nat-network":
+					nic.NATNetwork = val
+				}
+				info.NICs[i] = nic
+				continue
+			case "storagecontrollername":
+				for len(ctlNames) <= i {
+					ctlNames = append(ctlNames, "")
+				}
+				ctlNames[i] = val
+				continue
+			case "storagecontrollertype", "storagecontrollerportcount", "storagecontrollerbootable":
+				ctl := ctls[i]
+				if ctl == nil {
+					ctl = &StorageController{}
+					ctls[i] = ctl
+				}
+				switch res[1] {
+				case "storagecontrollertype":
+					ctl.Chipset = parseChipset(val)
+					ctl.SysBus = chipsetBus[ctl.Chipset]
+				case "storagecontrollerportcount":
+					n, err := parseUint(key, val)
+					if err != nil {
+						return nil, err
+					}
+					ctl.Ports = n
+				case "storagecontrollerbootable":
+					ctl.Bootable = val == "on"
+				}
+				continue
+			}
+		}
+	}
+
+	// Storage attachments are keyed by controller name, so they can only be
+	// recognized once every controller is known.
+	for i, name := range ctlNames {
+		if ctl := ctls[i]; ctl != nil {
+			info.StorageControllers[name] = *ctl
+		}
+	}
+	// Controller names may contain dashes, so prefer the longest match.
+	sort.Slice(ctlNames, func(i, j int) bool { return len(ctlNames[i]) > len(ctlNames[j]) })
+	for _, kv := range kvs {
+		// DVD drives are followed by "<controller>-IsEjected", which does
+		// not name the port and device.
+		if n := len(info.Attachments); n > 0 {
+			if last := &info.Attachments[n-1]; kv.key == last.Controller+"-IsEjected" && last.DriveType != DriveFDD {
+				last.DriveType = DriveDVD
+				continue
+			}
+		}
+		a, ok := info.parseAttachment(ctlNames, kv.key, kv.val)
+		if !ok || a.Medium == "none" {
+			continue
+		}
+		info.Attachments = append(info.Attachments, a)
+	}
+	for i := range info.Attachments {
+		a := &info.Attachments[i]
+		raw := func(name string) string {
+			return info.Raw[fmt.Sprintf("%s-%s-%d-%d", a.Controller, name, a.Port, a.Device)]
+		}
+		a.UUID = raw("ImageUUID")
+		if raw("IsEjected") != "" && a.DriveType != DriveFDD {
+			a.DriveType = DriveDVD
+		}
+		// VirtualBox 7 also reports the attachment options.
+		a.Hotpluggable = parseOnOff(raw("hot-pluggable"))
+		a.NonRotational = parseOnOff(raw("nonrotational"))
+		a.Discard = parseOnOff(raw("discard"))
+	}
+
+	for i := 1; i <= len(boot); i++ {
+		dev, ok := boot[i]
+		if !ok {
+			break
+		}
+		info.BootOrder = append(info.BootOrder, dev)
+	}
+
+	for _, id := range order {
+		info.SharedFolders = append(info.SharedFolders, *folders[id])
+	}
+	info.Snapshot = parseSnapshots(kvs)
+	return info, nil
+}
+
+// parseAttachment recognizes `"<controller>-<port>-<device>"=<medium>` keys,
+// trying the controller names in the given order.
+func (info *MachineInfo) parseAttachment(names []string, key, val string) (StorageAttachment, bool) {
+	for _, name := range names {
+		if name == "" || !strings.HasPrefix(key, name+"-") {
+			continue
+		}
+		res := reAttachment.FindStringSubmatch(key[len(name)+1:])
+		if res == nil || res[1] != "" {
+			return StorageAttachment{}, false
+		}
+		port, _ := strconv.ParseUint(res[2], 10, 32)
+		device, _ := strconv.ParseUint(res[3], 10, 32)
+		a := StorageAttachment{
+			Controller: name,
+			StorageMedium: StorageMedium{
+				Port:   uint(port),
+				Device: uint(device),
+				Medium: val,
+			},
+		}
+		// Images attached to DVD drives are recognized by the IsEjected key
+		// following them; see parseMachineInfo.
+		switch {
+		case info.StorageControllers[name].SysBus == SysBusFloppy:
+			a.DriveType = DriveFDD
+		case val == "emptydrive" || strings.HasPrefix(val, "host:"):
+			a.DriveType = DriveDVD
+		case val != "none":
+			a.DriveType = DriveHDD
+		}
+		return a, true
+	}
+	return StorageAttachment{}, false
+}
+
+// parseOnOff returns whether s is "on", or nil if s is empty.
+func parseOnOff(s string) *bool {
+	if s == "" {
+		return nil
+	}
+	return Bool(s == "on")
+}
@@ -0,0 +1,170 @@
+package virtualbox
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseMachineInfo(t *testing.T) {
+	info, err := parseMachineInfo(readFixture(t, "showvminfo.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "builder" || info.UUID != "c0d3a2b4-1f2e-4a5b-9c8d-7e6f5a4b3c2d" {
+		t.Errorf("got name %q uuid %q", info.Name, info.UUID)
+	}
+	if !reflect.DeepEqual(info.Groups, []string{"/ci", "/linux"}) {
+		t.Errorf("Groups = %q", info.Groups)
+	}
+	if info.OSType != "Ubuntu (64-bit)" || info.Firmware != "EFI" || info.State != Running {
+		t.Errorf("got ostype %q firmware %q state %q", info.OSType, info.Firmware, info.State)
+	}
+	if want := time.Date(2021, 3, 4, 5, 6, 7, 123000000, time.UTC); !info.StateChangeTime.Equal(want) {
+		t.Errorf("StateChangeTime = %v, want %v", info.StateChangeTime, want)
+	}
+	if info.CPUs != 2 || info.Memory != 2048 || info.VRAM != 16 || info.CPUExecutionCap != 100 {
+		t.Errorf("got cpus %d memory %d vram %d cap %d", info.CPUs, info.Memory, info.VRAM, info.CPUExecutionCap)
+	}
+	if info.BaseFolder != "/home/ci/VirtualBox VMs/builder" {
+		t.Errorf("BaseFolder = %q", info.BaseFolder)
+	}
+	wantFlag := F_acpi | F_ioapic | F_rtcuseutc | F_pae | F_longmode | F_hwvirtex | F_nestedpaging | F_vtxvpid | F_vtxux
+	if info.Flag != wantFlag {
+		t.Errorf("Flag = %b, want %b", info.Flag, wantFlag)
+	}
+	if !reflect.DeepEqual(info.BootOrder, []string{"disk", "dvd", "none", "none"}) {
+		t.Errorf("BootOrder = %q", info.BootOrder)
+	}
+	if info.Description != "Build machine.\nDo not delete." {
+		t.Errorf("Description = %q", info.Description)
+	}
+
+	wantNICs := map[int]NIC{
+		1: {Network: NICNetNAT, Hardware: IntelPro1000MTDesktop, MACAddress: "080027AB12CD"},
+		2: {Network: NICNetHostonly, Hardware: VirtIO, HostonlyAdapter: "vboxnet0", MACAddress: "080027EF3456"},
+		3: {Network: NICNetAbsent},
+		4: {Network: NICNetAbsent},
+		5: {Network: NICNetAbsent},
+		6: {Network: NICNetAbsent},
+		7: {Network: NICNetAbsent},
+		8: {Network: NICNetAbsent},
+	}
+	if !reflect.DeepEqual(info.NICs, wantNICs) {
+		t.Errorf("NICs = %+v", info.NICs)
+	}
+	wantPF := map[int]map[string]PFRule{1: {
+		"ssh": {Proto: PFTCP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 2222, GuestPort: 22},
+		"web": {Proto: PFTCP, HostPort: 8080, GuestPort: 80},
+	}}
+	if !reflect.DeepEqual(info.PortForwards, wantPF) {
+		t.Errorf("PortForwards = %+v", info.PortForwards)
+	}
+
+	wantCtls := map[string]StorageController{
+		"IDE":       {SysBus: SysBusIDE, Ports: 2, Chipset: CtrlPIIX4, Bootable: true},
+		"SATA-Main": {SysBus: SysBusSATA, Ports: 4, Chipset: CtrlIntelAHCI, Bootable: true},
+	}
+	if !reflect.DeepEqual(info.StorageControllers, wantCtls) {
+		t.Errorf("StorageControllers = %+v", info.StorageControllers)
+	}
+	wantAtts := []StorageAttachment{
+		{
+			Controller:    "IDE",
+			StorageMedium: StorageMedium{Port: 1, Device: 0, DriveType: DriveDVD, Medium: "/home/ci/iso/ubuntu-20.04.iso"},
+			UUID:          "5a7c2e3f-1111-4222-8333-944455556666",
+		},
+		{
+			Controller: "SATA-Main",
+			StorageMedium: StorageMedium{
+				Port: 0, Device: 0, DriveType: DriveHDD, Medium: "/home/ci/VirtualBox VMs/builder/builder-disk1.vdi",
+				Hotpluggable: Bool(false), NonRotational: Bool(true), Discard: Bool(true),
+			},
+			UUID: "9b8a7c6d-2222-4333-8444-a55566667777",
+		},
+	}
+	if !reflect.DeepEqual(info.Attachments, wantAtts) {
+		t.Errorf("Attachments = %+v", info.Attachments)
+	}
+
+	wantFolders := []SharedFolder{
+		{Name: "src", HostPath: "/home/ci/src"},
+		{Name: "tmp", HostPath: "/tmp/share", Transient: true},
+	}
+	if !reflect.DeepEqual(info.SharedFolders, wantFolders) {
+		t.Errorf("SharedFolders = %+v", info.SharedFolders)
+	}
+	if info.Raw["graphicscontroller"] != "vmsvga" || info.GraphicsController != "vmsvga" {
+		t.Errorf("graphicscontroller not parsed")
+	}
+}
+
+func TestParseMachineReadableEscapes(t *testing.T) {
+	kvs := parseMachineReadable(`name="say \"hi\""` + "\n" + `"C:\\VMs-0-0"="a\\b"` + "\n")
+	want := []keyValue{{"name", `say "hi"`}, {`C:\VMs-0-0`, `a\b`}}
+	if !reflect.DeepEqual(kvs, want) {
+		t.Errorf("got %q, want %q", kvs, want)
+	}
+}
+
+func TestParseMachineReadableUnescapedWindowsPaths(t *testing.T) {
+	// VirtualBox before 6.1 prints backslashes without escaping them.
+	out := `CfgFile="C:\Users\ci\VirtualBox VMs\new\new.vbox"` + "\n" +
+		`"SATA-0-0"="C:\new\vm.vdi"` + "\n" +
+		`SharedFolderPathMachineMapping1="\\fileserver\share"` + "\n"
+	want := []keyValue{
+		{"CfgFile", `C:\Users\ci\VirtualBox VMs\new\new.vbox`},
+		{"SATA-0-0", `C:\new\vm.vdi`},
+		{"SharedFolderPathMachineMapping1", `\\fileserver\share`},
+	}
+	if kvs := parseMachineReadable(out); !reflect.DeepEqual(kvs, want) {
+		t.Errorf("got %q, want %q", kvs, want)
+	}
+}
+
+func TestParseAttachmentDriveTypes(t *testing.T) {
+	out := `storagecontrollername0="IDE"
+storagecontrollertype0="PIIX4"
+storagecontrollername1="SATA"
+storagecontrollertype1="IntelAhci"
+"IDE-0-0"="host:/dev/sr0"
+"IDE-IsEjected"="off"
+"IDE-1-0"="/srv/images/installer.img"
+"IDE-ImageUUID-1-0"="5a7c2e3f-1111-4222-8333-944455556666"
+"IDE-IsEjected"="off"
+"SATA-0-0"="/srv/vms/disk.vdi"
+"SATA-ImageUUID-0-0"="9b8a7c6d-2222-4333-8444-a55566667777"
+"SATA-1-0"="/srv/images/tools"
+"SATA-IsEjected-1-0"="off"
+`
+	info, err := parseMachineInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]DriveType{
+		"host:/dev/sr0":             DriveDVD,
+		"/srv/images/installer.img": DriveDVD,
+		"/srv/vms/disk.vdi":         DriveHDD,
+		"/srv/images/tools":         DriveDVD,
+	}
+	if len(info.Attachments) != len(want) {
+		t.Fatalf("got attachments %+v", info.Attachments)
+	}
+	for _, a := range info.Attachments {
+		if a.DriveType != want[a.Medium] {
+			t.Errorf("%s: got %s, want %s", a.Medium, a.DriveType, want[a.Medium])
+		}
+	}
+}
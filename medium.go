@@ -0,0 +1,368 @@
+package virtualbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reMediumLine    = regexp.MustCompile(`^([^:\s][^:]*):\s+(.*)$`)
+	reMediumCreated = regexp.MustCompile(`UUID: ([0-9a-fA-F-]{36})`)
+	reMediumUser    = regexp.MustCompile(`^(.+?) \(UUID: ([0-9a-fA-F-]+)\)(?: \[(.*)\])?$`)
+	reMediumSnap    = regexp.MustCompile(`\(UUID: ([0-9a-fA-F-]+)\)`)
+	reMediumSize    = regexp.MustCompile(`^(\d+) ([KMGT]?)Bytes$`)
+)
+
+// ErrMediumCreation is returned when VBoxManage does not report the UUID of
+// a medium it created.
+var ErrMediumCreation = errors.New("failed to create medium")
+
+// MediumDevice is the kind of a medium.
+type MediumDevice string
+
+const (
+	MediumDisk   = MediumDevice("disk")
+	MediumDVD    = MediumDevice("dvd")
+	MediumFloppy = MediumDevice("floppy")
+)
+
+// MediumType controls how a medium behaves when it is attached and when
+// snapshots are taken.
+type MediumType string
+
+const (
+	MediumNormal       = MediumType("normal")
+	MediumImmutable    = MediumType("immutable")
+	MediumWritethrough = MediumType("writethrough")
+	MediumShareable    = MediumType("shareable")
+	MediumReadonly     = MediumType("readonly")
+	MediumMultiattach  = MediumType("multiattach")
+)
+
+// MediumFormat is the file format of a medium.
+type MediumFormat string
+
+const (
+	FormatVDI  = MediumFormat("VDI")
+	FormatVMDK = MediumFormat("VMDK")
+	FormatVHD  = MediumFormat("VHD")
+)
+
+// MediumVariant is a storage variant of a medium. Variants are combined with
+// commas, e.g. "Fixed,Split2G".
+type MediumVariant string
+
+const (
+	VariantStandard = MediumVariant("Standard")
+	VariantFixed    = MediumVariant("Fixed")
+	VariantSplit2G  = MediumVariant("Split2G")
+	VariantStream   = MediumVariant("Stream")
+	VariantESX      = MediumVariant("ESX")
+)
+
+// Medium is a disk, DVD or floppy image known to VirtualBox, as reported by
+// `VBoxManage showmediuminfo`.
+type Medium struct {
+	Device       MediumDevice
+	UUID         string
+	ParentUUID   string // empty for base media
+	Parent       *Medium
+	Children     []string // UUIDs of differencing children
+	State        string   // e.g. created, inaccessible, "locked write"
+	Type         MediumType
+	Differencing bool
+	AutoReset    bool
+	Location     string
+	Format       MediumFormat
+	Variant      string
+	Capacity     uint64 // logical size in bytes
+	Size         uint64 // actual size on disk in bytes
+	Properties   map[string]string
+	Machines     []MediumUser
+
+	client *Client
+}
+
+// MediumUser is a machine a medium is attached to, in its current state or
+// in snapshots.
+type MediumUser struct {
+	Name      string
+	UUID      string
+	Snapshots []string // UUIDs of snapshots using the medium
+}
+
+// Base returns the base medium of the differencing chain m belongs to. The
+// chain is only known for media returned by GetMedium.
+func (m *Medium) Base() *Medium {
+	for m.Parent != nil {
+		m = m.Parent
+	}
+	return m
+}
+
+// GetMedium gets the medium with the given UUID or file name, along with its
+// chain of parents.
+func GetMedium(ctx context.Context, device MediumDevice, id string) (*Medium, error) {
+	return DefaultClient.GetMedium(ctx, device, id)
+}
+
+// GetMedium gets the medium with the given UUID or file name, along with its
+// chain of parents.
+func (c *Client) GetMedium(ctx context.Context, device MediumDevice, id string) (*Medium, error) {
+	m, err := c.showMedium(ctx, device, id)
+	if err != nil {
+		return nil, err
+	}
+	for p := m; p.ParentUUID != ""; p = p.Parent {
+		if p.Parent, err = c.showMedium(ctx, device, p.ParentUUID); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// showMedium gets a single medium.
+func (c *Client) showMedium(ctx context.Context, device MediumDevice, id string) (*Medium, error) {
+	out, err := c.vbmOut(ctx, "showmediuminfo", string(device), id)
+	if err != nil {
+		return nil, err
+	}
+	m, err := parseMedium(out)
+	if err != nil {
+		return nil, err
+	}
+	m.Device, m.client = device, c
+	return m, nil
+}
+
+// parseMedium parses the output of `showmediuminfo`.
+func parseMedium(out string) (*Medium, error) {
+	m := &Medium{Properties: map[string]string{}}
+	var key string
+	s := bufio.NewScanner(strings.NewReader(out))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		val := strings.TrimSpace(line)
+		if res := reMediumLine.FindStringSubmatch(line); res != nil {
+			key, val = res[1], res[2]
+		} else if val == "" || !strings.HasPrefix(line, " ") {
+			continue
+		}
+		// Indented lines continue the value of the previous key.
+		switch key {
+		case "UUID":
+			m.UUID = val
+		case "Parent UUID":
+			if val != "base" {
+				m.ParentUUID = val
+			}
+		case "Child UUIDs":
+			m.Children = append(m.Children, val)
+		case "State":
+			m.State = val
+		case "Type":
+			t, kind, _ := strings.Cut(val, " ")
+			m.Type = MediumType(t)
+			m.Differencing = kind == "(differencing)"
+		case "Auto-Reset":
+			m.AutoReset = val == "on"
+		case "Location":
+			m.Location = val
+		case "Storage format":
+			m.Format = MediumFormat(val)
+		case "Format variant":
+			m.Variant = val
+		case "Capacity", "Size on disk", "Logical size", "Current size on disk":
+			n, err := parseMediumSize(val)
+			if err != nil {
+				return nil, fmt.Errorf("showmediuminfo: %s: %v", key, err)
+			}
+			if key == "Capacity" || key == "Logical size" {
+				m.Capacity = n
+			} else {
+				m.Size = n
+			}
+		case "Property":
+			k, v, _ := strings.Cut(val, "=")
+			m.Properties[k] = v
+		case "In use by VMs":
+			res := reMediumUser.FindStringSubmatch(val)
+			if res == nil {
+				continue
+			}
+			u := MediumUser{Name: res[1], UUID: res[2]}
+			for _, snap := range reMediumSnap.FindAllStringSubmatch(res[3], -1) {
+				u.Snapshots = append(u.Snapshots, snap[1])
+			}
+			m.Machines = append(m.Machines, u)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if m.UUID == "" {
+		return nil, fmt.Errorf("showmediuminfo: no medium UUID in output")
+	}
+	return m, nil
+}
+
+// parseMediumSize parses sizes such as "20480 MBytes".
+func parseMediumSize(s string) (uint64, error) {
+	res := reMediumSize.FindStringSubmatch(s)
+	if res == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseUint(res[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	var shift uint
+	if res[2] != "" {
+		shift = 10 * uint(strings.Index("KMGT", res[2])+1)
+	}
+	return n << shift, nil
+}
+
+// CreateMediumOptions configures CreateMedium.
+type CreateMediumOptions struct {
+	Device     MediumDevice // defaults to MediumDisk
+	Size       uint64       // in bytes; ignored for differencing media
+	Format     MediumFormat // defaults to VDI
+	Variant    []MediumVariant
+	DiffParent string // UUID or file name of the parent of a differencing medium
+}
+
+// CreateMedium creates a medium at filename.
+func CreateMedium(ctx context.Context, filename string, opts CreateMediumOptions) (*Medium, error) {
+	return DefaultClient.CreateMedium(ctx, filename, opts)
+}
+
+// CreateMedium creates a medium at filename.
+func (c *Client) CreateMedium(ctx context.Context, filename string, opts CreateMediumOptions) (*Medium, error) {
+	device := opts.Device
+	if device == "" {
+		device = MediumDisk
+	}
+	args := []string{"createmedium", string(device), "--filename", filename}
+	if opts.DiffParent != "" {
+		args = append(args, "--diffparent", opts.DiffParent)
+	} else {
+		args = append(args, "--sizebyte", strconv.FormatUint(opts.Size, 10))
+	}
+	if opts.Format != "" {
+		args = append(args, "--format", string(opts.Format))
+	}
+	if len(opts.Variant) > 0 {
+		args = append(args, "--variant", joinVariants(opts.Variant))
+	}
+	return c.newMedium(ctx, device, args...)
+}
+
+// CloneMediumOptions configures CloneMedium.
+type CloneMediumOptions struct {
+	Device   MediumDevice // defaults to MediumDisk
+	Format   MediumFormat // defaults to the format of the source
+	Variant  []MediumVariant
+	Existing bool // overwrite the contents of an existing target medium
+}
+
+// CloneMedium copies the medium with the given UUID or file name to target.
+func CloneMedium(ctx context.Context, source, target string, opts CloneMediumOptions) (*Medium, error) {
+	return DefaultClient.CloneMedium(ctx, source, target, opts)
+}
+
+// CloneMedium copies the medium with the given UUID or file name to target.
+func (c *Client) CloneMedium(ctx context.Context, source, target string, opts CloneMediumOptions) (*Medium, error) {
+	device := opts.Device
+	if device == "" {
+		device = MediumDisk
+	}
+	args := []string{"clonemedium", string(device), source, target}
+	if opts.Format != "" {
+		args = append(args, "--format", string(opts.Format))
+	}
+	if len(opts.Variant) > 0 {
+		args = append(args, "--variant", joinVariants(opts.Variant))
+	}
+	if opts.Existing {
+		args = append(args, "--existing")
+	}
+	return c.newMedium(ctx, device, args...)
+}
+
+// newMedium runs a command creating a medium and gets the new medium.
+func (c *Client) newMedium(ctx context.Context, device MediumDevice, args ...string) (*Medium, error) {
+	out, err := c.vbmOut(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	res := reMediumCreated.FindStringSubmatch(out)
+	if res == nil {
+		return nil, ErrMediumCreation
+	}
+	return c.GetMedium(ctx, device, res[1])
+}
+
+func joinVariants(vs []MediumVariant) string {
+	s := make([]string, len(vs))
+	for i, v := range vs {
+		s[i] = string(v)
+	}
+	return strings.Join(s, ",")
+}
+
+// Refresh reloads the medium information.
+func (m *Medium) Refresh(ctx context.Context) error {
+	fresh, err := m.client.orDefault().GetMedium(ctx, m.Device, m.UUID)
+	if err != nil {
+		return err
+	}
+	*m = *fresh
+	return nil
+}
+
+// modify runs `modifymedium` with the given options and refreshes m.
+func (m *Medium) modify(ctx context.Context, args ...string) error {
+	args = append([]string{"modifymedium", string(m.Device), m.UUID}, args...)
+	if err := m.client.orDefault().vbm(ctx, args...); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// Resize changes the logical size of the medium to size bytes. Only
+// growing is supported by most formats.
+func (m *Medium) Resize(ctx context.Context, size uint64) error {
+	return m.modify(ctx, "--resizebyte", strconv.FormatUint(size, 10))
+}
+
+// Compact releases blocks of the medium that only contain zeros.
+func (m *Medium) Compact(ctx context.Context) error {
+	return m.modify(ctx, "--compact")
+}
+
+// SetType changes the type of the medium.
+func (m *Medium) SetType(ctx context.Context, t MediumType) error {
+	return m.modify(ctx, "--type", string(t))
+}
+
+// SetAutoReset sets whether the differencing image of an immutable medium is
+// reset every time the machine starts.
+func (m *Medium) SetAutoReset(ctx context.Context, on bool) error {
+	return m.modify(ctx, "--autoreset", bool2string(on))
+}
+
+// Close removes the medium from the media registry, deleting its file as
+// well if deleteFile is true.
+func (m *Medium) Close(ctx context.Context, deleteFile bool) error {
+	args := []string{"closemedium", string(m.Device), m.UUID}
+	if deleteFile {
+		args = append(args, "--delete")
+	}
+	return m.client.orDefault().vbm(ctx, args...)
+}
@@ -0,0 +1,121 @@
+package virtualbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+const (
+	baseUUID = "2b1b4c5e-7d0a-4a8e-9f55-0c6b8e3f1a01"
+	diffUUID = "f1e2d3c4-b5a6-4978-8a9b-0c1d2e3f4a5b"
+)
+
+func mediumFakeVBM(t *testing.T) *fakeVBM {
+	f := newFakeVBM()
+	f.stdout["showmediuminfo disk "+baseUUID] = readFixture(t, "showmediuminfo-base.txt")
+	f.stdout["showmediuminfo disk "+diffUUID] = readFixture(t, "showmediuminfo-diff.txt")
+	return f
+}
+
+func TestGetMedium(t *testing.T) {
+	f := mediumFakeVBM(t)
+	m, err := f.client().GetMedium(context.Background(), MediumDisk, diffUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Differencing || m.Type != MediumNormal || m.State != "locked write" || m.Format != FormatVDI {
+		t.Errorf("got %+v", m)
+	}
+	if m.Capacity != 20480<<20 || m.Size != 18<<20 {
+		t.Errorf("sizes: got %d/%d", m.Capacity, m.Size)
+	}
+	base := m.Base()
+	if m.Parent == nil || base.UUID != baseUUID || base.Differencing {
+		t.Fatalf("parent chain: got %+v", m.Parent)
+	}
+	if !reflect.DeepEqual(base.Children, []string{diffUUID}) {
+		t.Errorf("children: got %q", base.Children)
+	}
+	if got := base.Properties["AllocationBlockSize"]; got != "1048576" {
+		t.Errorf("property: got %q", got)
+	}
+	want := []MediumUser{
+		{Name: "builder", UUID: "6e4ce8f7-4ef8-4d1e-a1a4-3b1f49b0c0de", Snapshots: []string{"0b3a7e4c-2f1d-4c6e-9a8b-5d7f3e2c1b0a"}},
+		{Name: "ci-1", UUID: "3c9d2e1f-8a7b-4c6d-9e0f-1a2b3c4d5e6f"},
+	}
+	if !reflect.DeepEqual(base.Machines, want) {
+		t.Errorf("machines: got %+v, want %+v", base.Machines, want)
+	}
+}
+
+func TestCreateMedium(t *testing.T) {
+	f := mediumFakeVBM(t)
+	f.stdout["createmedium disk --filename /vms/b.vdi --sizebyte 21474836480 --format VDI --variant Fixed,Split2G"] =
+		"0%...10%...100%\nMedium created. UUID: " + baseUUID + "\n"
+	m, err := f.client().CreateMedium(context.Background(), "/vms/b.vdi", CreateMediumOptions{
+		Size:    20 << 30,
+		Format:  FormatVDI,
+		Variant: []MediumVariant{VariantFixed, VariantSplit2G},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UUID != baseUUID {
+		t.Errorf("got %s", m.UUID)
+	}
+}
+
+func TestCloneMedium(t *testing.T) {
+	f := mediumFakeVBM(t)
+	f.stdout["clonemedium disk /vms/b.vdi /vms/c.vmdk --format VMDK"] =
+		"Clone medium created in format 'VMDK'. UUID: " + diffUUID + "\n"
+	m, err := f.client().CloneMedium(context.Background(), "/vms/b.vdi", "/vms/c.vmdk", CloneMediumOptions{Format: FormatVMDK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.UUID != diffUUID || m.Parent == nil {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestModifyMedium(t *testing.T) {
+	f := mediumFakeVBM(t)
+	ctx := context.Background()
+	m, err := f.client().GetMedium(ctx, MediumDisk, baseUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.calls = nil
+	if err := m.Resize(ctx, 40<<30); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetType(ctx, MediumMultiattach); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetAutoReset(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, c := range f.calls {
+		if c[0] != "showmediuminfo" {
+			got = append(got, c)
+		}
+	}
+	want := [][]string{
+		{"modifymedium", "disk", baseUUID, "--resizebyte", "42949672960"},
+		{"modifymedium", "disk", baseUUID, "--type", "multiattach"},
+		{"modifymedium", "disk", baseUUID, "--autoreset", "on"},
+		{"modifymedium", "disk", baseUUID, "--compact"},
+		{"closemedium", "disk", baseUUID, "--delete"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package mock_virtualbox
 
 import (
+	"context"
 	"github.com/markmarine/go-virtualbox"
 	"github.com/satori/go.uuid"
 	"strconv"
@@ -22,73 +23,90 @@ type MockMachine struct {
 	bootOrder  []string // max 4 slots, each in {none|floppy|dvd|disk|net}
 }
 
-func (m *MockMachine) Refresh() error {
+func (m *MockMachine) Refresh(ctx context.Context) error {
 	return nil
 }
 
-func (m *MockMachine) Start() error {
+func (m *MockMachine) Start(ctx context.Context) error {
 	m.state = virtualbox.Running
 	return nil
 }
 
-func (m *MockMachine) Save() error {
+func (m *MockMachine) Save(ctx context.Context) error {
 	m.state = virtualbox.Saved
 	return nil
 }
 
-func (m *MockMachine) Pause() error {
+func (m *MockMachine) Pause(ctx context.Context) error {
 	m.state = virtualbox.Paused
 	return nil
 }
 
 // Stop gracefully stops the machine.
-func (m *MockMachine) Stop() error {
+func (m *MockMachine) Stop(ctx context.Context) error {
+	m.state = virtualbox.Poweroff
+	return nil
+}
+
+// StopWithOptions gracefully stops the machine.
+func (m *MockMachine) StopWithOptions(ctx context.Context, opts virtualbox.StopOptions) error {
 	m.state = virtualbox.Poweroff
 	return nil
 }
 
 // Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
-func (m *MockMachine) Poweroff() error {
+func (m *MockMachine) Poweroff(ctx context.Context) error {
 	m.state = virtualbox.Poweroff
 	return nil
 }
 
+// WaitForState blocks until the machine is in one of the given states.
+func (m *MockMachine) WaitForState(ctx context.Context, states ...virtualbox.MachineState) error {
+	for _, s := range states {
+		if m.state == s {
+			return nil
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 // Restart gracefully restarts the machine.
-func (m *MockMachine) Restart() error {
-	return m.Start()
+func (m *MockMachine) Restart(ctx context.Context) error {
+	return m.Start(ctx)
 }
 
 // Reset forcefully restarts the machine. State is lost and might corrupt the disk image.
-func (m *MockMachine) Reset() error {
-	return m.Start()
+func (m *MockMachine) Reset(ctx context.Context) error {
+	return m.Start(ctx)
 }
 
 // Delete deletes the machine and associated disk images.
-func (m *MockMachine) Delete() error {
+func (m *MockMachine) Delete(ctx context.Context) error {
 	x := MockMachine{}
 	m = &x
 	return nil
 }
 
 // GetMachine finds a machine by its name or UUID.
-func GetMachine(id string) (*MockMachine, error) {
+func GetMachine(ctx context.Context, id string) (*MockMachine, error) {
 	// TODO find a better way to do this
 	m := MockMachine{name: id}
 	return &m, nil
 }
 
 // ListMachines lists all registered machines.
-func ListMachines() ([]*MockMachine, error) {
+func ListMachines(ctx context.Context) ([]*MockMachine, error) {
 	var ms []*MockMachine
 	for i:=0; i<3; i++ {
-		m, _ := CreateMachine("foo"+strconv.Itoa(i), "/bar")
+		m, _ := CreateMachine(ctx, "foo"+strconv.Itoa(i), "/bar")
 		ms = append(ms, m)
 	}
 	return ms, nil
 }
 
 // CreateMachine creates a new machine. If basefolder is empty, use default.
-func CreateMachine(name, basefolder string) (*MockMachine, error) {
+func CreateMachine(ctx context.Context, name, basefolder string) (*MockMachine, error) {
 	var m MockMachine
 	if name == "" {
 		m.name = "default"
@@ -109,40 +127,75 @@ func CreateMachine(name, basefolder string) (*MockMachine, error) {
 }
 
 // Modify changes the settings of the machine.
-func (m *MockMachine) Modify() error {
-	return m.Refresh()
+func (m *MockMachine) Modify(ctx context.Context) error {
+	return m.Refresh(ctx)
 }
 
 // AddNATPF adds a NAT port forarding rule to the n-th NIC with the given name.
-func (m *MockMachine) AddNATPF(n int, name string, rule virtualbox.PFRule) error {
+func (m *MockMachine) AddNATPF(ctx context.Context, n int, name string, rule virtualbox.PFRule) error {
 	return nil
 }
 
 // DelNATPF deletes the NAT port forwarding rule with the given name from the n-th NIC.
-func (m *MockMachine) DelNATPF(n int, name string) error {
+func (m *MockMachine) DelNATPF(ctx context.Context, n int, name string) error {
 	return nil
 }
 
 // SetNIC set the n-th NIC.
-func (m *MockMachine) SetNIC(n int, nic virtualbox.NIC) error {
+func (m *MockMachine) SetNIC(ctx context.Context, n int, nic virtualbox.NIC) error {
 	return nil
 }
 
 // AddStorageCtl adds a storage controller with the given name.
-func (m *MockMachine) AddStorageCtl(name string, ctl virtualbox.StorageController) error {
+func (m *MockMachine) AddStorageCtl(ctx context.Context, name string, ctl virtualbox.StorageController) error {
 	return nil
 }
 
 // DelStorageCtl deletes the storage controller with the given name.
-func (m *MockMachine) DelStorageCtl(name string) error {
+func (m *MockMachine) DelStorageCtl(ctx context.Context, name string) error {
 	return nil
 }
 
 // AttachStorage attaches a storage medium to the named storage controller.
-func (m *MockMachine) AttachStorage(ctlName string, medium virtualbox.StorageMedium) error {
+func (m *MockMachine) AttachStorage(ctx context.Context, ctlName string, medium virtualbox.StorageMedium) error {
+	return nil
+}
+
+// DetachStorage removes the drive at the given port and device of the named storage controller.
+func (m *MockMachine) DetachStorage(ctx context.Context, ctlName string, port, device uint) error {
+	return nil
+}
+
+// TakeSnapshot takes a snapshot of the machine.
+func (m *MockMachine) TakeSnapshot(ctx context.Context, name, description string, live bool) error {
+	return nil
+}
+
+// RestoreSnapshot restores the snapshot with the given name or UUID.
+func (m *MockMachine) RestoreSnapshot(ctx context.Context, id string) error {
+	return nil
+}
+
+// RestoreCurrent restores the current snapshot.
+func (m *MockMachine) RestoreCurrent(ctx context.Context) error {
 	return nil
 }
 
+// DeleteSnapshot deletes the snapshot with the given name or UUID.
+func (m *MockMachine) DeleteSnapshot(ctx context.Context, id string) error {
+	return nil
+}
+
+// EditSnapshot renames the snapshot and changes its description.
+func (m *MockMachine) EditSnapshot(ctx context.Context, id, name, description string) error {
+	return nil
+}
+
+// ListSnapshots returns the root of the machine's snapshot tree.
+func (m *MockMachine) ListSnapshots(ctx context.Context) (*virtualbox.Snapshot, error) {
+	return nil, nil
+}
+
 func (m *MockMachine) Name() string {
 	return m.name
 }
@@ -187,6 +240,29 @@ func (m *MockMachine) BootOrder() []string {
 	return m.bootOrder
 }
 
+func (m *MockMachine) StorageControllers() map[string]virtualbox.StorageController {
+	return nil
+}
+
+func (m *MockMachine) Attachments() []virtualbox.StorageAttachment {
+	return nil
+}
+
+func (m *MockMachine) Info() *virtualbox.MachineInfo {
+	return &virtualbox.MachineInfo{
+		Name:      m.name,
+		UUID:      m.uUID,
+		State:     m.state,
+		CPUs:      m.cPUs,
+		Memory:    m.memory,
+		VRAM:      m.vRAM,
+		CfgFile:   m.cfgFile,
+		OSType:    m.oSType,
+		Flag:      m.flag,
+		BootOrder: m.bootOrder,
+	}
+}
+
 func (m *MockMachine) SetName(name string) {
 	m.name = name
 }
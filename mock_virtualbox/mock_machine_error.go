@@ -1,6 +1,7 @@
 package mock_virtualbox
 
 import (
+	"context"
 	"github.com/markmarine/go-virtualbox"
 	"github.com/satori/go.uuid"
 	"fmt"
@@ -24,50 +25,60 @@ type MockMachineErr struct {
 
 var mockErr error = errors.New("mock os exit 1")
 
-func (m *MockMachineErr) Refresh() error {
+func (m *MockMachineErr) Refresh(ctx context.Context) error {
 	return mockErr
 }
 
-func (m *MockMachineErr) Start() error {
+func (m *MockMachineErr) Start(ctx context.Context) error {
 	return mockErr
 }
 
-func (m *MockMachineErr) Save() error {
+func (m *MockMachineErr) Save(ctx context.Context) error {
 	return mockErr
 }
 
-func (m *MockMachineErr) Pause() error {
+func (m *MockMachineErr) Pause(ctx context.Context) error {
 	return mockErr
 }
 
 // Stop gracefully stops the machine.
-func (m *MockMachineErr) Stop() error {
+func (m *MockMachineErr) Stop(ctx context.Context) error {
+	return mockErr
+}
+
+// StopWithOptions gracefully stops the machine.
+func (m *MockMachineErr) StopWithOptions(ctx context.Context, opts virtualbox.StopOptions) error {
 	return mockErr
 }
 
 // Poweroff forcefully stops the machine. State is lost and might corrupt the disk image.
-func (m *MockMachineErr) Poweroff() error {
+func (m *MockMachineErr) Poweroff(ctx context.Context) error {
+	return mockErr
+}
+
+// WaitForState blocks until the machine is in one of the given states.
+func (m *MockMachineErr) WaitForState(ctx context.Context, states ...virtualbox.MachineState) error {
 	return mockErr
 }
 
 // Restart gracefully restarts the machine.
-func (m *MockMachineErr) Restart() error {
-	return m.Start()
+func (m *MockMachineErr) Restart(ctx context.Context) error {
+	return m.Start(ctx)
 }
 
 // Reset forcefully restarts the machine. State is lost and might corrupt the disk image.
-func (m *MockMachineErr) Reset() error {
-	return m.Start()
+func (m *MockMachineErr) Reset(ctx context.Context) error {
+	return m.Start(ctx)
 }
 
 // Delete deletes the machine and associated disk images.
-func (m *MockMachineErr) Delete() error {
+func (m *MockMachineErr) Delete(ctx context.Context) error {
 	return mockErr
 }
 
 
 // CreateMachine creates a new machine. If basefolder is empty, use default.
-func CreateMachineErr(name, basefolder string) (*MockMachineErr, error) {
+func CreateMachineErr(ctx context.Context, name, basefolder string) (*MockMachineErr, error) {
 	var m MockMachineErr
 	if name == "" {
 		m.name = "default"
@@ -88,40 +99,75 @@ func CreateMachineErr(name, basefolder string) (*MockMachineErr, error) {
 }
 
 // Modify changes the settings of the machine.
-func (m *MockMachineErr) Modify() error {
-	return m.Refresh()
+func (m *MockMachineErr) Modify(ctx context.Context) error {
+	return m.Refresh(ctx)
 }
 
 // AddNATPF adds a NAT port forarding rule to the n-th NIC with the given name.
-func (m *MockMachineErr) AddNATPF(n int, name string, rule virtualbox.PFRule) error {
+func (m *MockMachineErr) AddNATPF(ctx context.Context, n int, name string, rule virtualbox.PFRule) error {
 	return mockErr
 }
 
 // DelNATPF deletes the NAT port forwarding rule with the given name from the n-th NIC.
-func (m *MockMachineErr) DelNATPF(n int, name string) error {
+func (m *MockMachineErr) DelNATPF(ctx context.Context, n int, name string) error {
 	return mockErr
 }
 
 // SetNIC set the n-th NIC.
-func (m *MockMachineErr) SetNIC(n int, nic virtualbox.NIC) error {
+func (m *MockMachineErr) SetNIC(ctx context.Context, n int, nic virtualbox.NIC) error {
 	return mockErr
 }
 
 // AddStorageCtl adds a storage controller with the given name.
-func (m *MockMachineErr) AddStorageCtl(name string, ctl virtualbox.StorageController) error {
+func (m *MockMachineErr) AddStorageCtl(ctx context.Context, name string, ctl virtualbox.StorageController) error {
 	return mockErr
 }
 
 // DelStorageCtl deletes the storage controller with the given name.
-func (m *MockMachineErr) DelStorageCtl(name string) error {
+func (m *MockMachineErr) DelStorageCtl(ctx context.Context, name string) error {
 	return mockErr
 }
 
 // AttachStorage attaches a storage medium to the named storage controller.
-func (m *MockMachineErr) AttachStorage(ctlName string, medium virtualbox.StorageMedium) error {
+func (m *MockMachineErr) AttachStorage(ctx context.Context, ctlName string, medium virtualbox.StorageMedium) error {
+	return mockErr
+}
+
+// DetachStorage removes the drive at the given port and device of the named storage controller.
+func (m *MockMachineErr) DetachStorage(ctx context.Context, ctlName string, port, device uint) error {
 	return mockErr
 }
 
+// TakeSnapshot takes a snapshot of the machine.
+func (m *MockMachineErr) TakeSnapshot(ctx context.Context, name, description string, live bool) error {
+	return mockErr
+}
+
+// RestoreSnapshot restores the snapshot with the given name or UUID.
+func (m *MockMachineErr) RestoreSnapshot(ctx context.Context, id string) error {
+	return mockErr
+}
+
+// RestoreCurrent restores the current snapshot.
+func (m *MockMachineErr) RestoreCurrent(ctx context.Context) error {
+	return mockErr
+}
+
+// DeleteSnapshot deletes the snapshot with the given name or UUID.
+func (m *MockMachineErr) DeleteSnapshot(ctx context.Context, id string) error {
+	return mockErr
+}
+
+// EditSnapshot renames the snapshot and changes its description.
+func (m *MockMachineErr) EditSnapshot(ctx context.Context, id, name, description string) error {
+	return mockErr
+}
+
+// ListSnapshots returns the root of the machine's snapshot tree.
+func (m *MockMachineErr) ListSnapshots(ctx context.Context) (*virtualbox.Snapshot, error) {
+	return nil, mockErr
+}
+
 func (m *MockMachineErr) Name() string {
 	return m.name
 }
@@ -166,6 +212,29 @@ func (m *MockMachineErr) BootOrder() []string {
 	return m.bootOrder
 }
 
+func (m *MockMachineErr) StorageControllers() map[string]virtualbox.StorageController {
+	return nil
+}
+
+func (m *MockMachineErr) Attachments() []virtualbox.StorageAttachment {
+	return nil
+}
+
+func (m *MockMachineErr) Info() *virtualbox.MachineInfo {
+	return &virtualbox.MachineInfo{
+		Name:      m.name,
+		UUID:      m.uUID,
+		State:     m.state,
+		CPUs:      m.cPUs,
+		Memory:    m.memory,
+		VRAM:      m.vRAM,
+		CfgFile:   m.cfgFile,
+		OSType:    m.oSType,
+		Flag:      m.flag,
+		BootOrder: m.bootOrder,
+	}
+}
+
 func (m *MockMachineErr) SetName(name string) {
 	m.name = name
 }
@@ -2,68 +2,300 @@ package virtualbox
 
 import (
 	"bufio"
+	"context"
+	"fmt"
 	"net"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+var reNATNetLine = regexp.MustCompile(`^([^:\s][^:]*):\s*(.*)$`)
+
 // A NATNet defines a NAT network.
 type NATNet struct {
-	Name    string
-	IPv4    net.IPNet
-	IPv6    net.IPNet
-	DHCP    bool
-	Enabled bool
+	Name        string
+	IPv4        net.IPNet // network address and mask
+	Gateway     net.IP    // address of the NAT service in the network
+	IPv6        net.IPNet // IPv6 prefix; not applied by VirtualBox 6
+	IPv6Enabled bool
+	IPv6Default bool // advertise a default IPv6 route to the guests; not applied by VirtualBox 6
+	DHCP        bool
+	Enabled     bool
+
+	PortForwards4 map[string]PFRule // IPv4 port forwarding rules keyed by name
+	PortForwards6 map[string]PFRule // IPv6 port forwarding rules keyed by name
+	Loopback4     map[string]uint   // host loopback addresses mapped to guest address offsets
+
+	client *Client
+}
+
+// CreateNATNet creates a NAT network with the settings of n. The network
+// is named n.Name and covers the CIDR of n.IPv4.
+func CreateNATNet(ctx context.Context, n NATNet) (*NATNet, error) {
+	return DefaultClient.CreateNATNet(ctx, n)
+}
+
+// CreateNATNet creates a NAT network with the settings of n. The network
+// is named n.Name and covers the CIDR of n.IPv4.
+func (c *Client) CreateNATNet(ctx context.Context, n NATNet) (*NATNet, error) {
+	n.client = c
+	args, err := n.args(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.vbm(ctx, append([]string{"natnetwork", "add"}, args...)...); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// args returns the natnetwork add/modify options for the settings of n.
+// VirtualBox 6 rejects the IPv6 prefix and default route options, so they
+// are only passed to VirtualBox 7 and later.
+func (n *NATNet) args(ctx context.Context) ([]string, error) {
+	network := net.IPNet{IP: n.IPv4.IP.Mask(n.IPv4.Mask), Mask: n.IPv4.Mask}
+	args := []string{
+		"--netname", n.Name,
+		"--network", network.String(),
+		"--dhcp", bool2string(n.DHCP),
+		"--ipv6", bool2string(n.IPv6Enabled),
+	}
+	ipv6Opts := false
+	if n.IPv6Enabled {
+		major, err := n.client.orDefault().majorVersion(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ipv6Opts = major >= 7
+	}
+	if ipv6Opts {
+		if n.IPv6.IP != nil && n.IPv6.Mask != nil {
+			prefix := net.IPNet{IP: n.IPv6.IP.Mask(n.IPv6.Mask), Mask: n.IPv6.Mask}
+			args = append(args, "--ipv6-prefix", prefix.String())
+		}
+		args = append(args, "--ipv6-default", bool2string(n.IPv6Default))
+	}
+	if n.Enabled {
+		args = append(args, "--enable")
+	} else {
+		args = append(args, "--disable")
+	}
+	return args, nil
+}
+
+// Modify applies the settings of n to the NAT network named n.Name.
+func (n *NATNet) Modify(ctx context.Context) error {
+	args, err := n.args(ctx)
+	if err != nil {
+		return err
+	}
+	return n.client.orDefault().vbm(ctx, append([]string{"natnetwork", "modify"}, args...)...)
+}
+
+// Start starts the NAT service of the network.
+func (n *NATNet) Start(ctx context.Context) error {
+	return n.client.orDefault().vbm(ctx, "natnetwork", "start", "--netname", n.Name)
+}
+
+// Stop stops the NAT service of the network.
+func (n *NATNet) Stop(ctx context.Context) error {
+	return n.client.orDefault().vbm(ctx, "natnetwork", "stop", "--netname", n.Name)
+}
+
+// Refresh reloads the settings of the NAT network, including its port
+// forwarding rules and loopback mappings.
+func (n *NATNet) Refresh(ctx context.Context) error {
+	nets, err := n.client.orDefault().NATNets(ctx)
+	if err != nil {
+		return err
+	}
+	fresh, ok := nets[n.Name]
+	if !ok {
+		return fmt.Errorf("NAT network %s: %w", n.Name, ErrNotFound)
+	}
+	*n = fresh
+	return nil
+}
+
+// AddPortForward adds a port forwarding rule to the network. The rule is an
+// IPv6 rule if its guest IP is an IPv6 address. NAT networks need the guest
+// IP of every rule.
+func (n *NATNet) AddPortForward(ctx context.Context, name string, rule PFRule) error {
+	opt := "--port-forward-4"
+	if rule.GuestIP != nil && rule.GuestIP.To4() == nil {
+		opt = "--port-forward-6"
+	}
+	return n.client.orDefault().vbm(ctx, "natnetwork", "modify", "--netname", n.Name, opt, rule.formatNATNet(name))
+}
+
+// DelPortForward deletes the IPv4 or IPv6 port forwarding rule with the
+// given name.
+func (n *NATNet) DelPortForward(ctx context.Context, name string, ipv6 bool) error {
+	opt := "--port-forward-4"
+	if ipv6 {
+		opt = "--port-forward-6"
+	}
+	return n.client.orDefault().vbm(ctx, "natnetwork", "modify", "--netname", n.Name, opt, "delete", name)
+}
+
+// AddLoopback maps the host loopback address addr to the guest address at
+// offset in the network, so guests can reach services bound to addr.
+func (n *NATNet) AddLoopback(ctx context.Context, addr net.IP, offset uint) error {
+	return n.client.orDefault().vbm(ctx, "natnetwork", "modify", "--netname", n.Name,
+		"--loopback-4", fmt.Sprintf("%s=%d", addr, offset))
+}
+
+// DelLoopback deletes the mapping of the host loopback address addr.
+func (n *NATNet) DelLoopback(ctx context.Context, addr net.IP) error {
+	return n.client.orDefault().vbm(ctx, "natnetwork", "modify", "--netname", n.Name,
+		"--loopback-4", "delete", addr.String())
+}
+
+// Remove deletes the NAT network.
+func (n *NATNet) Remove(ctx context.Context) error {
+	return n.client.orDefault().vbm(ctx, "natnetwork", "remove", "--netname", n.Name)
+}
+
+// NATNets gets all NAT networks in a  map keyed by NATNet.Name.
+func NATNets(ctx context.Context) (map[string]NATNet, error) {
+	return DefaultClient.NATNets(ctx)
 }
 
 // NATNets gets all NAT networks in a  map keyed by NATNet.Name.
-func NATNets() (map[string]NATNet, error) {
-	out, err := vbmOut("list", "natnets")
+func (c *Client) NATNets(ctx context.Context) (map[string]NATNet, error) {
+	out, err := c.vbmOut(ctx, "list", "natnets")
 	if err != nil {
 		return nil, err
 	}
-	s := bufio.NewScanner(strings.NewReader(out))
+	return parseNATNets(out, c)
+}
+
+// parseNATNets parses the output of `list natnets`. VirtualBox 7 renamed
+// most keys, e.g. NetworkName to Name and IP to Gateway.
+func parseNATNets(out string, c *Client) (map[string]NATNet, error) {
 	m := map[string]NATNet{}
-	n := NATNet{}
+	var n *NATNet
+	flush := func() {
+		if n != nil && n.Name != "" {
+			m[n.Name] = *n
+		}
+		n = nil
+	}
+	var section string // list of rules or mappings the following lines belong to
+	s := bufio.NewScanner(strings.NewReader(out))
 	for s.Scan() {
-		line := s.Text()
-		if line == "" {
-			m[n.Name] = n
-			n = NATNet{}
+		line := strings.TrimRight(s.Text(), "\r")
+		text := strings.TrimSpace(line)
+		switch {
+		case text == "":
+			flush()
+			section = ""
+			continue
+		case text == "Port-forwarding (ipv4)", text == "Port-forwarding (ipv6)", text == "loopback mappings (ipv4)":
+			section = text
+			continue
+		case text != line:
+			if section == "" || n == nil {
+				continue
+			}
+			if err := n.parseListEntry(section, text); err != nil {
+				return nil, err
+			}
 			continue
 		}
-		res := reColonLine.FindStringSubmatch(line)
+		section = ""
+		res := reNATNetLine.FindStringSubmatch(line)
 		if res == nil {
 			continue
 		}
-		switch key, val := res[1], res[2]; key {
-		case "NetworkName":
-			n.Name = val
-		case "IP":
-			n.IPv4.IP = net.ParseIP(val)
+		key, val := res[1], res[2]
+		if key == "NetworkName" || key == "Name" {
+			// Records are not always separated by blank lines.
+			flush()
+			n = &NATNet{Name: val, client: c}
+			continue
+		}
+		if n == nil {
+			continue
+		}
+		switch key {
+		case "IP", "Gateway":
+			n.Gateway = net.ParseIP(val)
 		case "Network":
 			_, ipnet, err := net.ParseCIDR(val)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("list natnets: %s: %v", key, err)
 			}
-			n.IPv4.Mask = ipnet.Mask
+			n.IPv4 = *ipnet
+		case "IPv6 Enabled", "IPv6":
+			n.IPv6Enabled = val == "Yes"
 		case "IPv6 Prefix":
-			if val == "" {
-				continue
-			}
-			l, err := strconv.ParseUint(val, 10, 7)
-			if err != nil {
-				return nil, err
+			if err := n.parseIPv6Prefix(val); err != nil {
+				return nil, fmt.Errorf("list natnets: %s: %v", key, err)
 			}
-			n.IPv6.Mask = net.CIDRMask(int(l), net.IPv6len*8)
-		case "DHCP Enabled":
-			n.DHCP = (val == "Yes")
+		case "IPv6 Default":
+			n.IPv6Default = val == "Yes"
+		case "DHCP Enabled", "DHCP Server":
+			n.DHCP = val == "Yes"
 		case "Enabled":
-			n.Enabled = (val == "Yes")
+			n.Enabled = val == "Yes"
 		}
 	}
 	if err := s.Err(); err != nil {
 		return nil, err
 	}
+	flush()
 	return m, nil
 }
+
+// parseIPv6Prefix parses the IPv6 prefix of a NAT network, which is a CIDR,
+// or only the prefix length in old VirtualBox versions.
+func (n *NATNet) parseIPv6Prefix(val string) error {
+	switch {
+	case val == "":
+	case strings.Contains(val, "/"):
+		_, ipnet, err := net.ParseCIDR(val)
+		if err != nil {
+			return err
+		}
+		n.IPv6 = *ipnet
+	default:
+		l, err := strconv.ParseUint(val, 10, 8)
+		if err != nil || l > 128 {
+			return fmt.Errorf("invalid prefix length %q", val)
+		}
+		n.IPv6.Mask = net.CIDRMask(int(l), net.IPv6len*8)
+	}
+	return nil
+}
+
+// parseListEntry parses an indented port forwarding rule or loopback
+// mapping of `list natnets`.
+func (n *NATNet) parseListEntry(section, text string) error {
+	if section == "loopback mappings (ipv4)" {
+		addr, offset, _ := strings.Cut(text, "=")
+		off, err := strconv.ParseUint(offset, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid loopback mapping %q: %v", text, err)
+		}
+		if n.Loopback4 == nil {
+			n.Loopback4 = map[string]uint{}
+		}
+		n.Loopback4[addr] = uint(off)
+		return nil
+	}
+	name, rule, err := parseNATNetPFRule(text)
+	if err != nil {
+		return err
+	}
+	rules := &n.PortForwards4
+	if section == "Port-forwarding (ipv6)" {
+		rules = &n.PortForwards6
+	}
+	if *rules == nil {
+		*rules = map[string]PFRule{}
+	}
+	(*rules)[name] = rule
+	return nil
+}
@@ -1,11 +1,208 @@
 package virtualbox
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func TestNATNets(t *testing.T) {
-	m, err := NATNets()
+	m, err := NATNets(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("%+v", m)
 }
+
+func TestNATNetLifecycle(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["--version"] = "7.0.10r158379\n"
+	ctx := context.Background()
+	_, ipnet, _ := net.ParseCIDR("10.0.3.0/24")
+	_, prefix, _ := net.ParseCIDR("fd17:625c:f037:3::/64")
+	n, err := f.client().CreateNATNet(ctx, NATNet{Name: "lab", IPv4: *ipnet, DHCP: true, Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.IPv6, n.IPv6Enabled, n.IPv6Default = *prefix, true, true
+	n.DHCP = false
+	if err := n.Modify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []func(context.Context) error{n.Start, n.Stop, n.Remove} {
+		if err := op(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"natnetwork add --netname lab --network 10.0.3.0/24 --dhcp on --ipv6 off --enable",
+		"--version",
+		"natnetwork modify --netname lab --network 10.0.3.0/24 --dhcp off --ipv6 on --ipv6-prefix fd17:625c:f037:3::/64 --ipv6-default on --enable",
+		"natnetwork start --netname lab",
+		"natnetwork stop --netname lab",
+		"natnetwork remove --netname lab",
+	}
+	var got []string
+	for _, args := range f.calls {
+		got = append(got, strings.Join(args, " "))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNATNetModifyIPv6Old(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["--version"] = "6.1.46r158378\n"
+	_, ipnet, _ := net.ParseCIDR("10.0.3.0/24")
+	_, prefix, _ := net.ParseCIDR("fd17:625c:f037:3::/64")
+	n := &NATNet{Name: "lab", IPv4: *ipnet, IPv6: *prefix, IPv6Enabled: true, IPv6Default: true, client: f.client()}
+	if err := n.Modify(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"natnetwork", "modify", "--netname", "lab", "--network", "10.0.3.0/24", "--dhcp", "off", "--ipv6", "on", "--disable"}
+	if got := f.calls[len(f.calls)-1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNATNetPortForwards(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["list natnets"] = readFixture(t, "natnets-6.txt")
+	ctx := context.Background()
+	n := &NATNet{Name: "lab", client: f.client()}
+	if err := n.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want4 := map[string]PFRule{
+		"ssh": {Proto: PFTCP, HostPort: 1022, GuestIP: net.ParseIP("10.0.3.5"), GuestPort: 22},
+		"dns": {Proto: PFUDP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 5353, GuestIP: net.ParseIP("10.0.3.6"), GuestPort: 53},
+	}
+	if !reflect.DeepEqual(n.PortForwards4, want4) {
+		t.Errorf("PortForwards4 = %+v", n.PortForwards4)
+	}
+	want6 := map[string]PFRule{
+		"web": {Proto: PFTCP, HostPort: 8080, GuestIP: net.ParseIP("fd17:625c:f037:3::5"), GuestPort: 80},
+	}
+	if !reflect.DeepEqual(n.PortForwards6, want6) {
+		t.Errorf("PortForwards6 = %+v", n.PortForwards6)
+	}
+	if want := map[string]uint{"127.0.0.1": 2, "127.0.1.1": 6}; !reflect.DeepEqual(n.Loopback4, want) {
+		t.Errorf("Loopback4 = %+v", n.Loopback4)
+	}
+
+	f.calls = nil
+	if err := n.AddPortForward(ctx, "ssh", want4["ssh"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.AddPortForward(ctx, "web", want6["web"]); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DelPortForward(ctx, "web", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.AddLoopback(ctx, net.ParseIP("127.0.2.1"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DelLoopback(ctx, net.ParseIP("127.0.2.1")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"natnetwork modify --netname lab --port-forward-4 ssh:tcp:[]:1022:[10.0.3.5]:22",
+		"natnetwork modify --netname lab --port-forward-6 web:tcp:[]:8080:[fd17:625c:f037:3::5]:80",
+		"natnetwork modify --netname lab --port-forward-6 delete web",
+		"natnetwork modify --netname lab --loopback-4 127.0.2.1=10",
+		"natnetwork modify --netname lab --loopback-4 delete 127.0.2.1",
+	}
+	var got []string
+	for _, args := range f.calls {
+		got = append(got, strings.Join(args, " "))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	n.Name = "missing"
+	if err := n.Refresh(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestParseNATNets(t *testing.T) {
+	cidr := func(s string) net.IPNet {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *ipnet
+	}
+	for _, tc := range []struct {
+		fixture string
+		want    map[string]NATNet
+	}{
+		{"natnets-5.txt", map[string]NATNet{
+			"NatNetwork": {
+				Name: "NatNetwork", IPv4: cidr("10.0.2.0/24"), Gateway: net.ParseIP("10.0.2.1"),
+				IPv6: cidr("fd17:625c:f037:2::/64"), DHCP: true, Enabled: true,
+				Loopback4: map[string]uint{"127.0.0.1": 2},
+			},
+			// The last record is not followed by a blank line.
+			"ci": {
+				Name: "ci", IPv4: cidr("192.168.50.0/24"), Gateway: net.ParseIP("192.168.50.1"),
+				PortForwards4: map[string]PFRule{
+					"rdp": {Proto: PFTCP, HostPort: 13389, GuestIP: net.ParseIP("192.168.50.10"), GuestPort: 3389},
+				},
+				Loopback4: map[string]uint{"127.0.0.1": 2},
+			},
+		}},
+		{"natnets-6.txt", map[string]NATNet{
+			"lab": {
+				Name: "lab", IPv4: cidr("10.0.3.0/24"), Gateway: net.ParseIP("10.0.3.1"),
+				IPv6: cidr("fd17:625c:f037:3::/64"), IPv6Enabled: true, DHCP: true, Enabled: true,
+				PortForwards4: map[string]PFRule{
+					"ssh": {Proto: PFTCP, HostPort: 1022, GuestIP: net.ParseIP("10.0.3.5"), GuestPort: 22},
+					"dns": {Proto: PFUDP, HostIP: net.ParseIP("127.0.0.1"), HostPort: 5353, GuestIP: net.ParseIP("10.0.3.6"), GuestPort: 53},
+				},
+				PortForwards6: map[string]PFRule{
+					"web": {Proto: PFTCP, HostPort: 8080, GuestIP: net.ParseIP("fd17:625c:f037:3::5"), GuestPort: 80},
+				},
+				Loopback4: map[string]uint{"127.0.0.1": 2, "127.0.1.1": 6},
+			},
+			"NatNetwork": {
+				Name: "NatNetwork", IPv4: cidr("10.0.2.0/24"), Gateway: net.ParseIP("10.0.2.1"),
+				IPv6: cidr("fd17:625c:f037:2::/64"), DHCP: true,
+				Loopback4: map[string]uint{"127.0.0.1": 2},
+			},
+		}},
+		{"natnets-7.txt", map[string]NATNet{
+			"NatNetwork": {
+				Name: "NatNetwork", IPv4: cidr("10.0.2.0/24"), Gateway: net.ParseIP("10.0.2.1"),
+				IPv6: cidr("fd17:625c:f037:2::/64"), DHCP: true, Enabled: true,
+				Loopback4: map[string]uint{"127.0.0.1": 2},
+			},
+			"perf": {
+				Name: "perf", IPv4: cidr("172.16.9.0/24"), Gateway: net.ParseIP("172.16.9.1"),
+				IPv6: cidr("fd00:9::/64"), IPv6Enabled: true, IPv6Default: true, Enabled: true,
+				PortForwards4: map[string]PFRule{
+					"iperf": {Proto: PFTCP, HostPort: 15201, GuestIP: net.ParseIP("172.16.9.20"), GuestPort: 5201},
+				},
+				PortForwards6: map[string]PFRule{
+					"iperf6": {Proto: PFTCP, HostPort: 15202, GuestIP: net.ParseIP("fd00:9::20"), GuestPort: 5201},
+				},
+				Loopback4: map[string]uint{"127.0.0.1": 2},
+			},
+		}},
+	} {
+		got, err := parseNATNets(readFixture(t, tc.fixture), nil)
+		if err != nil {
+			t.Errorf("%s: %v", tc.fixture, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.fixture, got, tc.want)
+		}
+	}
+}
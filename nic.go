@@ -5,6 +5,11 @@ type NIC struct {
 	Network         NICNetwork
 	Hardware        NICHardware
 	HostonlyAdapter string
+	HostonlyNetwork string // name of a VirtualBox 7 host-only network
+	BridgeAdapter   string
+	InternalNetwork string
+	NATNetwork      string
+	MACAddress      string // 12 hex digits without separators; empty means unchanged
 }
 
 // NICNetwork represents the type of NIC networks.
@@ -14,9 +19,11 @@ const (
 	NICNetAbsent       = NICNetwork("none")
 	NICNetDisconnected = NICNetwork("null")
 	NICNetNAT          = NICNetwork("nat")
+	NICNetNATNetwork   = NICNetwork("natnetwork")
 	NICNetBridged      = NICNetwork("bridged")
 	NICNetInternal     = NICNetwork("intnet")
 	NICNetHostonly     = NICNetwork("hostonly")
+	NICNetHostonlyNet  = NICNetwork("hostonlynet") // VirtualBox 7 host-only network
 	NICNetGeneric      = NICNetwork("generic")
 )
 
@@ -0,0 +1,309 @@
+// Package ova packages disk images and a machine description into an OVA
+// appliance without VirtualBox.
+package ova
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	virtualbox "github.com/markmarine/go-virtualbox"
+	"github.com/markmarine/go-virtualbox/ovf"
+	"github.com/markmarine/go-virtualbox/vmdk"
+)
+
+// Disk is a disk image to include in an appliance.
+type Disk struct {
+	Path string // image on the host
+	Name string // file name in the OVA; defaults to the base name of Path
+
+	// Convert converts the image to a streamOptimized VMDK. Path is then
+	// read as a sparse VMDK or, failing that, as a raw disk image. Without
+	// Convert, Path must be a sparse VMDK.
+	Convert bool
+}
+
+// Machine describes the virtual system of an appliance.
+type Machine struct {
+	Name    string
+	OSType  string // VirtualBox guest OS type, e.g. "Ubuntu_64"
+	CPUs    uint
+	Memory  uint // in MB
+	NICs    []virtualbox.NIC
+	Product *ovf.ProductSection
+
+	// Controller is the storage controller the disks are attached to, one
+	// per port, or one per device on IDE. The zero value means a SATA
+	// (AHCI) controller. Its Ports, if set, limits the ports used.
+	Controller virtualbox.StorageController
+	Disks      []Disk
+}
+
+// WriteFile writes an OVA of m to path.
+func WriteFile(path string, m *Machine) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, m); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// Write writes an OVA of m to w: the OVF descriptor, a manifest of SHA256
+// digests and the disk images, in that order. Converted disks are staged in
+// temporary files.
+func Write(w io.Writer, m *Machine) error {
+	if m.Name == "" {
+		return errors.New("ova: machine has no name")
+	}
+	files := make([]file, 0, len(m.Disks))
+	defer func() {
+		for _, f := range files {
+			if f.temp {
+				os.Remove(f.path)
+			}
+		}
+	}()
+	for _, d := range m.Disks {
+		f, err := prepare(d)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	e, err := envelope(m, files)
+	if err != nil {
+		return err
+	}
+	desc, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	ovfName := m.Name + ".ovf"
+	sum := sha256.Sum256(desc)
+	var mf strings.Builder
+	fmt.Fprintf(&mf, "SHA256(%s)= %s\n", ovfName, hex.EncodeToString(sum[:]))
+	for _, f := range files {
+		fmt.Fprintf(&mf, "SHA256(%s)= %s\n", f.name, f.digest)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeEntry(tw, ovfName, int64(len(desc)), bytes.NewReader(desc)); err != nil {
+		return err
+	}
+	if err := writeEntry(tw, m.Name+".mf", int64(mf.Len()), strings.NewReader(mf.String())); err != nil {
+		return err
+	}
+	for _, f := range files {
+		r, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		err = writeEntry(tw, f.name, f.size, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// file is a disk image ready to be packaged.
+type file struct {
+	path     string
+	name     string
+	temp     bool // path is a temporary file
+	size     int64
+	capacity int64
+	format   string
+	digest   string
+}
+
+// prepare converts d if requested and gathers what the descriptor and the
+// manifest need to know about it.
+func prepare(d Disk) (file, error) {
+	f := file{path: d.Path, name: d.Name}
+	if f.name == "" {
+		f.name = filepath.Base(d.Path)
+		if d.Convert && !strings.EqualFold(filepath.Ext(f.name), ".vmdk") {
+			f.name = strings.TrimSuffix(f.name, filepath.Ext(f.name)) + ".vmdk"
+		}
+	}
+	src, err := os.Open(d.Path)
+	if err != nil {
+		return f, err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return f, err
+	}
+
+	img, err := vmdk.NewReader(src, fi.Size())
+	switch {
+	case err == nil && !d.Convert:
+		f.capacity = img.Size()
+		f.format = ovf.FormatSparse
+		if img.StreamOptimized() {
+			f.format = ovf.FormatStreamOptimized
+		}
+	case err == nil || errors.Is(err, vmdk.ErrNotVMDK) && d.Convert:
+		var r io.Reader = src
+		f.capacity = fi.Size()
+		if err == nil {
+			r = io.NewSectionReader(img, 0, img.Size())
+			f.capacity = img.Size()
+		}
+		tmp, err := os.CreateTemp("", "ova-*.vmdk")
+		if err != nil {
+			return f, err
+		}
+		f.path, f.temp = tmp.Name(), true
+		err = vmdk.WriteStreamOptimized(tmp, r, f.capacity)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.path)
+			return f, fmt.Errorf("ova: converting %s: %w", d.Path, err)
+		}
+		f.format = ovf.FormatStreamOptimized
+	default:
+		return f, fmt.Errorf("ova: %s: %w", d.Path, err)
+	}
+
+	if f.size, f.digest, err = digest(f.path); err != nil {
+		if f.temp {
+			os.Remove(f.path)
+		}
+		return f, err
+	}
+	return f, nil
+}
+
+// digest returns the size and hex SHA256 digest of the file at path.
+func digest(path string) (int64, string, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// envelope builds the OVF descriptor of m.
+func envelope(m *Machine, files []file) (*ovf.Envelope, error) {
+	e := ovf.New(m.Name)
+	vs := e.System
+	vs.Product = m.Product
+	if m.OSType != "" {
+		vs.OperatingSystem = &ovf.OperatingSystemSection{
+			ID:          1, // CIM "Other"; VirtualBox uses vbox:OSType
+			Info:        "The kind of installed guest operating system",
+			Description: m.OSType,
+			OSType:      m.OSType,
+		}
+	}
+	h := &vs.Hardware
+	if m.CPUs > 0 {
+		h.SetCPUs(m.CPUs)
+	}
+	if m.Memory > 0 {
+		h.SetMemory(m.Memory)
+	}
+	for _, nic := range m.NICs {
+		if _, err := e.AddNIC(nic); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return e, nil
+	}
+	ctl := m.Controller
+	if ctl.Chipset == "" {
+		ctl = virtualbox.StorageController{SysBus: virtualbox.SysBusSATA, Chipset: virtualbox.CtrlIntelAHCI}
+	}
+	ctlID, err := h.AddStorageController(ctl)
+	if err != nil {
+		return nil, err
+	}
+	ports, devices, err := slots(h, ctlID, ctl.Ports)
+	if err != nil {
+		return nil, err
+	}
+	if uint(len(files)) > ports*devices {
+		return nil, fmt.Errorf("ova: %d disks do not fit on %d ports of the %s controller", len(files), ports, ctl.Chipset)
+	}
+	names := map[string]bool{}
+	for i, f := range files {
+		if names[f.name] {
+			return nil, fmt.Errorf("ova: duplicate disk name %s", f.name)
+		}
+		names[f.name] = true
+		id := fmt.Sprintf("vmdisk%d", i+1)
+		e.AddDisk(id, f.name, f.size, f.capacity, f.format)
+		if _, err := h.AddAttachment(ctlID, virtualbox.StorageMedium{
+			Port:      uint(i) / devices,
+			Device:    uint(i) % devices,
+			DriveType: virtualbox.DriveHDD,
+			Medium:    id,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// slots returns the number of ports of the controller with the given
+// instance ID and of devices per port, limited to ports if non-zero.
+func slots(h *ovf.VirtualHardwareSection, ctlID string, ports uint) (uint, uint, error) {
+	for _, ctl := range h.StorageControllers() {
+		if ctl.ID != ctlID {
+			continue
+		}
+		max := ctl.SysBus.MaxPorts()
+		if ports == 0 || ports > max {
+			ports = max
+		}
+		if ctl.SysBus == virtualbox.SysBusIDE {
+			return ports, 2, nil // master and slave
+		}
+		return ports, 1, nil
+	}
+	return 0, 0, fmt.Errorf("ova: storage controller %s not found", ctlID)
+}
+
+// writeEntry writes a regular file to the archive in the ustar format the
+// OVF specification requires.
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:   name,
+		Mode:   0644,
+		Size:   size,
+		Format: tar.FormatUSTAR,
+	})
+	if err != nil {
+		return fmt.Errorf("ova: %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("ova: %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package ova
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	virtualbox "github.com/markmarine/go-virtualbox"
+	"github.com/markmarine/go-virtualbox/ovf"
+	"github.com/markmarine/go-virtualbox/vmdk"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	raw := make([]byte, 4<<20)
+	copy(raw, "boot sector")
+	rawPath := filepath.Join(dir, "root.img")
+	if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err := Write(&b, &Machine{
+		Name:   "ci",
+		OSType: "Ubuntu_64",
+		CPUs:   2,
+		Memory: 2048,
+		NICs:   []virtualbox.NIC{{Network: virtualbox.NICNetNAT, Hardware: virtualbox.IntelPro1000MTDesktop}},
+		Disks:  []Disk{{Path: rawPath, Convert: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	contents := map[string][]byte{}
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		contents[hdr.Name] = data
+	}
+	if got, want := strings.Join(names, " "), "ci.ovf ci.mf root.vmdk"; got != want {
+		t.Fatalf("entries: got %q, want %q", got, want)
+	}
+
+	for _, name := range []string{"ci.ovf", "root.vmdk"} {
+		sum := sha256.Sum256(contents[name])
+		line := fmt.Sprintf("SHA256(%s)= %s\n", name, hex.EncodeToString(sum[:]))
+		if !strings.Contains(string(contents["ci.mf"]), line) {
+			t.Errorf("manifest lacks %q:\n%s", line, contents["ci.mf"])
+		}
+	}
+
+	e, err := ovf.Parse(bytes.NewReader(contents["ci.ovf"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := e.Disk("vmdisk1")
+	if disk == nil || disk.Format != ovf.FormatStreamOptimized {
+		t.Fatalf("disk: got %+v", disk)
+	}
+	if n, _ := disk.CapacityBytes(); n != int64(len(raw)) {
+		t.Errorf("capacity: got %d", n)
+	}
+	if f := e.File(disk.FileRef); f == nil || f.Href != "root.vmdk" || f.Size != int64(len(contents["root.vmdk"])) {
+		t.Errorf("file: got %+v", f)
+	}
+	if atts := e.System.Hardware.Attachments(); len(atts) != 1 || atts[0].Medium != "vmdisk1" {
+		t.Errorf("attachments: got %+v", atts)
+	}
+
+	img, err := vmdk.NewReader(bytes.NewReader(contents["root.vmdk"]), int64(len(contents["root.vmdk"])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(raw))
+	if _, err := img.ReadAt(got, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Error("disk contents changed")
+	}
+}
+
+func TestWriteRejectsRawImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "root.img")
+	if err := os.WriteFile(path, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := Write(io.Discard, &Machine{Name: "ci", Disks: []Disk{{Path: path}}})
+	if err == nil {
+		t.Error("packaged a raw image without converting it")
+	}
+}
+
+func TestEnvelopePorts(t *testing.T) {
+	files := make([]file, 5)
+	for i := range files {
+		files[i] = file{name: fmt.Sprintf("disk%d.vmdk", i), size: 1, capacity: 1 << 20, format: ovf.FormatStreamOptimized}
+	}
+	ide := virtualbox.StorageController{SysBus: virtualbox.SysBusIDE, Chipset: virtualbox.CtrlPIIX4}
+	e, err := envelope(&Machine{Name: "ci", Controller: ide}, files[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range e.System.Hardware.Attachments() {
+		got = append(got, fmt.Sprintf("%d:%d", a.Port, a.Device))
+	}
+	if want := "0:0 0:1 1:0 1:1"; strings.Join(got, " ") != want {
+		t.Errorf("got IDE slots %s, want %s", got, want)
+	}
+	if _, err := envelope(&Machine{Name: "ci", Controller: ide}, files); err == nil {
+		t.Error("attached 5 disks to an IDE controller")
+	}
+
+	sata := virtualbox.StorageController{SysBus: virtualbox.SysBusSATA, Chipset: virtualbox.CtrlIntelAHCI, Ports: 4}
+	if _, err := envelope(&Machine{Name: "ci", Controller: sata}, files); err == nil {
+		t.Error("attached 5 disks to 4 SATA ports")
+	}
+}
@@ -0,0 +1,461 @@
+package ovf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	virtualbox "github.com/markmarine/go-virtualbox"
+)
+
+// ResourceType is the CIM resource type of a virtual hardware item.
+type ResourceType int
+
+const (
+	ResourceOther           ResourceType = 1
+	ResourceProcessor       ResourceType = 3
+	ResourceMemory          ResourceType = 4
+	ResourceIDEController   ResourceType = 5
+	ResourceSCSIController  ResourceType = 6
+	ResourceEthernetAdapter ResourceType = 10
+	ResourceFloppyDrive     ResourceType = 14
+	ResourceCDDrive         ResourceType = 15
+	ResourceDVDDrive        ResourceType = 16
+	ResourceDisk            ResourceType = 17
+	ResourceOtherStorage    ResourceType = 20 // SATA and other controllers
+	ResourceUSBController   ResourceType = 23
+	ResourceSoundCard       ResourceType = 35
+)
+
+// VirtualHardwareSection lists the virtual hardware of a virtual system.
+type VirtualHardwareSection struct {
+	Info   string          `xml:"Info"`
+	System *SystemSettings `xml:"System"`
+	Items  []Item          `xml:"Item"`
+
+	version string // OVF version the section is marshaled for
+}
+
+// MarshalXML writes the section. For OVF 2.0, disks are written as
+// StorageItem and network adapters as EthernetPortItem elements.
+func (h VirtualHardwareSection) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type plain VirtualHardwareSection
+	if h.version != "2.0" {
+		return enc.EncodeElement(plain(h), start)
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := enc.EncodeElement(h.Info, xml.StartElement{Name: xml.Name{Local: "Info"}}); err != nil {
+		return err
+	}
+	if h.System != nil {
+		if err := enc.EncodeElement(h.System, xml.StartElement{Name: xml.Name{Local: "System"}}); err != nil {
+			return err
+		}
+	}
+	for _, it := range h.Items {
+		var v interface{} = it
+		name := "Item"
+		switch it.ResourceType {
+		case ResourceDisk:
+			v, name = storageItem(it), "StorageItem"
+		case ResourceEthernetAdapter:
+			v, name = ethernetPortItem(it), "EthernetPortItem"
+		}
+		if err := enc.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// SystemSettings identifies the virtual hardware family.
+type SystemSettings struct {
+	ElementName             string `xml:"vssd:ElementName"`
+	InstanceID              string `xml:"vssd:InstanceID"`
+	VirtualSystemIdentifier string `xml:"vssd:VirtualSystemIdentifier,omitempty"`
+	VirtualSystemType       string `xml:"vssd:VirtualSystemType,omitempty"`
+}
+
+// Item is a virtual hardware item (CIM_ResourceAllocationSettingData). The
+// fields are in schema order.
+type Item struct {
+	Address             string       `xml:"rasd:Address,omitempty"`
+	AddressOnParent     string       `xml:"rasd:AddressOnParent,omitempty"`
+	AllocationUnits     string       `xml:"rasd:AllocationUnits,omitempty"`
+	AutomaticAllocation *bool        `xml:"rasd:AutomaticAllocation,omitempty"`
+	Caption             string       `xml:"rasd:Caption,omitempty"`
+	Connection          string       `xml:"rasd:Connection,omitempty"`
+	Description         string       `xml:"rasd:Description,omitempty"`
+	ElementName         string       `xml:"rasd:ElementName"`
+	HostResource        string       `xml:"rasd:HostResource,omitempty"`
+	InstanceID          string       `xml:"rasd:InstanceID"`
+	Parent              string       `xml:"rasd:Parent,omitempty"`
+	ResourceSubType     string       `xml:"rasd:ResourceSubType,omitempty"`
+	ResourceType        ResourceType `xml:"rasd:ResourceType"`
+	VirtualQuantity     uint64       `xml:"rasd:VirtualQuantity,omitempty"`
+}
+
+// storageItem is an Item written as an OVF 2.0 StorageItem
+// (CIM_StorageAllocationSettingData).
+type storageItem struct {
+	Address             string       `xml:"sasd:Address,omitempty"`
+	AddressOnParent     string       `xml:"sasd:AddressOnParent,omitempty"`
+	AllocationUnits     string       `xml:"sasd:AllocationUnits,omitempty"`
+	AutomaticAllocation *bool        `xml:"sasd:AutomaticAllocation,omitempty"`
+	Caption             string       `xml:"sasd:Caption,omitempty"`
+	Connection          string       `xml:"sasd:Connection,omitempty"`
+	Description         string       `xml:"sasd:Description,omitempty"`
+	ElementName         string       `xml:"sasd:ElementName"`
+	HostResource        string       `xml:"sasd:HostResource,omitempty"`
+	InstanceID          string       `xml:"sasd:InstanceID"`
+	Parent              string       `xml:"sasd:Parent,omitempty"`
+	ResourceSubType     string       `xml:"sasd:ResourceSubType,omitempty"`
+	ResourceType        ResourceType `xml:"sasd:ResourceType"`
+	VirtualQuantity     uint64       `xml:"sasd:VirtualQuantity,omitempty"`
+}
+
+// ethernetPortItem is an Item written as an OVF 2.0 EthernetPortItem
+// (CIM_EthernetPortAllocationSettingData).
+type ethernetPortItem struct {
+	Address             string       `xml:"epasd:Address,omitempty"`
+	AddressOnParent     string       `xml:"epasd:AddressOnParent,omitempty"`
+	AllocationUnits     string       `xml:"epasd:AllocationUnits,omitempty"`
+	AutomaticAllocation *bool        `xml:"epasd:AutomaticAllocation,omitempty"`
+	Caption             string       `xml:"epasd:Caption,omitempty"`
+	Connection          string       `xml:"epasd:Connection,omitempty"`
+	Description         string       `xml:"epasd:Description,omitempty"`
+	ElementName         string       `xml:"epasd:ElementName"`
+	HostResource        string       `xml:"epasd:HostResource,omitempty"`
+	InstanceID          string       `xml:"epasd:InstanceID"`
+	Parent              string       `xml:"epasd:Parent,omitempty"`
+	ResourceSubType     string       `xml:"epasd:ResourceSubType,omitempty"`
+	ResourceType        ResourceType `xml:"epasd:ResourceType"`
+	VirtualQuantity     uint64       `xml:"epasd:VirtualQuantity,omitempty"`
+}
+
+// Item returns the item with the given instance ID, or nil.
+func (h *VirtualHardwareSection) Item(id string) *Item {
+	for i := range h.Items {
+		if h.Items[i].InstanceID == id {
+			return &h.Items[i]
+		}
+	}
+	return nil
+}
+
+// ItemsOf returns the items of the given resource type, in order.
+func (h *VirtualHardwareSection) ItemsOf(typ ResourceType) []*Item {
+	var items []*Item
+	for i := range h.Items {
+		if h.Items[i].ResourceType == typ {
+			items = append(items, &h.Items[i])
+		}
+	}
+	return items
+}
+
+// add appends it with the next free instance ID and returns that ID.
+func (h *VirtualHardwareSection) add(it Item) string {
+	next := 1
+	for _, it := range h.Items {
+		if n, err := strconv.Atoi(it.InstanceID); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	it.InstanceID = strconv.Itoa(next)
+	h.Items = append(h.Items, it)
+	return it.InstanceID
+}
+
+// set updates the single item of the given resource type, adding it if
+// there is none.
+func (h *VirtualHardwareSection) set(it Item) {
+	if items := h.ItemsOf(it.ResourceType); len(items) > 0 {
+		it.InstanceID = items[0].InstanceID
+		*items[0] = it
+		return
+	}
+	h.add(it)
+}
+
+// CPUs returns the number of virtual CPUs, or 0 if not set.
+func (h *VirtualHardwareSection) CPUs() uint {
+	if items := h.ItemsOf(ResourceProcessor); len(items) > 0 {
+		return uint(items[0].VirtualQuantity)
+	}
+	return 0
+}
+
+// SetCPUs sets the number of virtual CPUs.
+func (h *VirtualHardwareSection) SetCPUs(n uint) {
+	h.set(Item{
+		Caption:         fmt.Sprintf("%d virtual CPU", n),
+		Description:     "Number of virtual CPUs",
+		ElementName:     fmt.Sprintf("%d virtual CPU", n),
+		ResourceType:    ResourceProcessor,
+		VirtualQuantity: uint64(n),
+	})
+}
+
+// Memory returns the main memory in MB, or 0 if not set.
+func (h *VirtualHardwareSection) Memory() (uint, error) {
+	items := h.ItemsOf(ResourceMemory)
+	if len(items) == 0 {
+		return 0, nil
+	}
+	unit, err := unitBytes(items[0].AllocationUnits)
+	if err != nil {
+		return 0, fmt.Errorf("ovf: memory: %v", err)
+	}
+	return uint(items[0].VirtualQuantity * unit >> 20), nil
+}
+
+// SetMemory sets the main memory in MB.
+func (h *VirtualHardwareSection) SetMemory(mb uint) {
+	h.set(Item{
+		AllocationUnits: "MegaBytes",
+		Caption:         fmt.Sprintf("%d MB of memory", mb),
+		Description:     "Memory Size",
+		ElementName:     fmt.Sprintf("%d MB of memory", mb),
+		ResourceType:    ResourceMemory,
+		VirtualQuantity: uint64(mb),
+	})
+}
+
+// controllerTypes maps storage controller chipsets to their OVF resource
+// type and subtype. The first entry of a chipset is used when writing.
+var controllerTypes = []struct {
+	typ     ResourceType
+	subtype string
+	bus     virtualbox.SystemBus
+	chipset virtualbox.StorageControllerChipset
+}{
+	{ResourceIDEController, "PIIX3", virtualbox.SysBusIDE, virtualbox.CtrlPIIX3},
+	{ResourceIDEController, "PIIX4", virtualbox.SysBusIDE, virtualbox.CtrlPIIX4},
+	{ResourceIDEController, "ICH6", virtualbox.SysBusIDE, virtualbox.CtrlICH6},
+	{ResourceSCSIController, "lsilogic", virtualbox.SysBusSCSI, virtualbox.CtrlLSILogic},
+	{ResourceSCSIController, "buslogic", virtualbox.SysBusSCSI, virtualbox.CtrlBusLogic},
+	{ResourceOtherStorage, "LsiLogicSAS", virtualbox.SysBusSAS, virtualbox.CtrlLSILogicSAS},
+	{ResourceSCSIController, "lsilogicsas", virtualbox.SysBusSAS, virtualbox.CtrlLSILogicSAS},
+	{ResourceOtherStorage, "AHCI", virtualbox.SysBusSATA, virtualbox.CtrlIntelAHCI},
+	{ResourceOtherStorage, "NVMe", virtualbox.SysBusPCIe, virtualbox.CtrlNVMe},
+	{ResourceOtherStorage, "VirtioSCSI", virtualbox.SysBusVirtio, virtualbox.CtrlVirtIO},
+	{ResourceOtherStorage, "USB", virtualbox.SysBusUSB, virtualbox.CtrlUSB},
+}
+
+// Controller is a storage controller item.
+type Controller struct {
+	ID string // instance ID of the item
+	virtualbox.StorageController
+}
+
+// StorageControllers returns the storage controllers of the hardware
+// section. Items with unknown subtypes are skipped.
+func (h *VirtualHardwareSection) StorageControllers() []Controller {
+	var ctls []Controller
+	for _, it := range h.Items {
+		for _, t := range controllerTypes {
+			if it.ResourceType == t.typ && strings.EqualFold(it.ResourceSubType, t.subtype) {
+				ctls = append(ctls, Controller{
+					ID:                it.InstanceID,
+					StorageController: virtualbox.StorageController{SysBus: t.bus, Chipset: t.chipset},
+				})
+				break
+			}
+		}
+	}
+	return ctls
+}
+
+// AddStorageController adds a storage controller and returns its instance
+// ID.
+func (h *VirtualHardwareSection) AddStorageController(ctl virtualbox.StorageController) (string, error) {
+	for _, t := range controllerTypes {
+		if t.chipset != ctl.Chipset {
+			continue
+		}
+		address := 0
+		for _, it := range h.Items {
+			if it.ResourceType == t.typ {
+				address++
+			}
+		}
+		name := fmt.Sprintf("%sController%d", strings.ToLower(string(t.bus)), address)
+		return h.add(Item{
+			Address:         strconv.Itoa(address),
+			Caption:         name,
+			Description:     fmt.Sprintf("%s Controller", strings.ToUpper(string(t.bus))),
+			ElementName:     name,
+			ResourceSubType: t.subtype,
+			ResourceType:    t.typ,
+		}), nil
+	}
+	return "", fmt.Errorf("ovf: unsupported storage controller chipset %q", ctl.Chipset)
+}
+
+// Attachment is a drive attached to a storage controller.
+type Attachment struct {
+	Controller string // instance ID of the controller item
+	virtualbox.StorageMedium
+}
+
+// Attachments returns the drives attached to storage controllers. For hard
+// disks, Medium is the ID of the disk in the DiskSection.
+func (h *VirtualHardwareSection) Attachments() []Attachment {
+	var atts []Attachment
+	for _, it := range h.Items {
+		var drive virtualbox.DriveType
+		switch it.ResourceType {
+		case ResourceDisk:
+			drive = virtualbox.DriveHDD
+		case ResourceCDDrive, ResourceDVDDrive:
+			drive = virtualbox.DriveDVD
+		case ResourceFloppyDrive:
+			drive = virtualbox.DriveFDD
+		default:
+			continue
+		}
+		a := Attachment{Controller: it.Parent}
+		a.DriveType = drive
+		addr, _ := strconv.ParseUint(it.AddressOnParent, 10, 32)
+		a.Port = uint(addr)
+		if ctl := h.Item(it.Parent); ctl != nil && ctl.ResourceType == ResourceIDEController {
+			// IDE addresses count master and slave of both channels.
+			a.Port, a.Device = uint(addr/2), uint(addr%2)
+		}
+		a.Medium = diskID(it.HostResource)
+		if a.Medium == "" && drive == virtualbox.DriveDVD {
+			a.Medium = "emptydrive"
+		}
+		atts = append(atts, a)
+	}
+	return atts
+}
+
+// AddAttachment attaches a drive to the controller with the given instance
+// ID. For hard disks, m.Medium must be the ID of a disk in the DiskSection.
+func (h *VirtualHardwareSection) AddAttachment(ctl string, m virtualbox.StorageMedium) (string, error) {
+	parent := h.Item(ctl)
+	if parent == nil {
+		return "", fmt.Errorf("ovf: no storage controller with instance ID %s", ctl)
+	}
+	addr := m.Port
+	if parent.ResourceType == ResourceIDEController {
+		addr = m.Port*2 + m.Device
+	}
+	it := Item{
+		AddressOnParent: strconv.FormatUint(uint64(addr), 10),
+		Parent:          ctl,
+	}
+	switch m.DriveType {
+	case virtualbox.DriveHDD:
+		if m.Medium == "" {
+			return "", fmt.Errorf("ovf: hard disk on controller %s has no disk ID", ctl)
+		}
+		it.ElementName = "disk" + it.AddressOnParent
+		it.Description = "Disk Image"
+		it.HostResource = "ovf:/disk/" + m.Medium
+		it.ResourceType = ResourceDisk
+	case virtualbox.DriveDVD:
+		it.ElementName = "cdrom" + it.AddressOnParent
+		it.Description = "CD-ROM Drive"
+		it.AutomaticAllocation = new(bool)
+		it.ResourceType = ResourceCDDrive
+	case virtualbox.DriveFDD:
+		it.ElementName = "floppy" + it.AddressOnParent
+		it.Description = "Floppy Drive"
+		it.AutomaticAllocation = new(bool)
+		it.ResourceType = ResourceFloppyDrive
+	default:
+		return "", fmt.Errorf("ovf: unsupported drive type %q", m.DriveType)
+	}
+	it.Caption = it.ElementName
+	return h.add(it), nil
+}
+
+// diskID returns the disk ID of a host resource such as "/disk/vmdisk1" or
+// "ovf:/disk/vmdisk1".
+func diskID(res string) string {
+	res = strings.TrimPrefix(res, "ovf:")
+	if id, ok := strings.CutPrefix(res, "/disk/"); ok {
+		return id
+	}
+	return ""
+}
+
+// nicHardware maps Ethernet adapter subtypes to NIC hardware. VirtualBox
+// writes the same subtype for all PCnet and all Intel adapters.
+var nicHardware = map[string]virtualbox.NICHardware{
+	"PCNet32": virtualbox.AMDPCNetFASTIII,
+	"E1000":   virtualbox.IntelPro1000MTDesktop,
+	"virtio":  virtualbox.VirtIO,
+}
+
+// nicConnections maps the logical network names VirtualBox exports to NIC
+// networks.
+var nicConnections = map[string]virtualbox.NICNetwork{
+	"NAT":        virtualbox.NICNetNAT,
+	"NATNetwork": virtualbox.NICNetNATNetwork,
+	"Bridged":    virtualbox.NICNetBridged,
+	"HostOnly":   virtualbox.NICNetHostonly,
+	"Internal":   virtualbox.NICNetInternal,
+	"Generic":    virtualbox.NICNetGeneric,
+}
+
+// NICs returns the Ethernet adapters in order. Adapters connected to a
+// network not known to VirtualBox are reported as generic.
+func (h *VirtualHardwareSection) NICs() []virtualbox.NIC {
+	var nics []virtualbox.NIC
+	for _, it := range h.ItemsOf(ResourceEthernetAdapter) {
+		nic := virtualbox.NIC{Network: virtualbox.NICNetGeneric}
+		for sub, hw := range nicHardware {
+			if strings.EqualFold(it.ResourceSubType, sub) {
+				nic.Hardware = hw
+			}
+		}
+		if n, ok := nicConnections[it.Connection]; ok {
+			nic.Network = n
+		}
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+// AddNIC adds an Ethernet adapter to the virtual system and its network to
+// the NetworkSection, and returns the instance ID of the new item.
+func (e *Envelope) AddNIC(nic virtualbox.NIC) (string, error) {
+	if e.System == nil {
+		return "", fmt.Errorf("ovf: envelope has no virtual system")
+	}
+	var conn string
+	for name, n := range nicConnections {
+		if n == nic.Network {
+			conn = name
+		}
+	}
+	if conn == "" {
+		return "", fmt.Errorf("ovf: unsupported NIC network %q", nic.Network)
+	}
+	var subtype string
+	switch nic.Hardware {
+	case virtualbox.AMDPCNetPCIII, virtualbox.AMDPCNetFASTIII:
+		subtype = "PCNet32"
+	case virtualbox.VirtIO:
+		subtype = "virtio"
+	default:
+		subtype = "E1000"
+	}
+	e.AddNetwork(conn)
+	automatic := true
+	return e.System.Hardware.add(Item{
+		AutomaticAllocation: &automatic,
+		Caption:             fmt.Sprintf("Ethernet adapter on '%s'", conn),
+		Connection:          conn,
+		ElementName:         fmt.Sprintf("Ethernet adapter on '%s'", conn),
+		ResourceSubType:     subtype,
+		ResourceType:        ResourceEthernetAdapter,
+	}), nil
+}
@@ -0,0 +1,407 @@
+// Package ovf reads and writes OVF descriptors, the XML envelopes describing
+// the virtual systems, disks and networks of an appliance.
+//
+// Elements and attributes keep their conventional prefixes (ovf:, rasd:,
+// vssd:, vbox:) in the struct tags, whatever prefixes the parsed document
+// declared. OVF 1.0 and 2.0 envelopes are supported; the StorageItem and
+// EthernetPortItem elements of OVF 2.0 are read as plain Items, and written
+// again for disks and network adapters.
+package ovf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Namespaces of the elements and attributes used in OVF descriptors.
+const (
+	NamespaceOVF1  = "http://schemas.dmtf.org/ovf/envelope/1"
+	NamespaceOVF2  = "http://schemas.dmtf.org/ovf/envelope/2"
+	NamespaceRASD  = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData"
+	NamespaceSASD  = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_StorageAllocationSettingData"
+	NamespaceEPASD = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_EthernetPortAllocationSettingData"
+	NamespaceVSSD  = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData"
+	NamespaceVBox  = "http://www.virtualbox.org/ovf/machine"
+	NamespaceXSI   = "http://www.w3.org/2001/XMLSchema-instance"
+	namespaceXML   = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Disk format URIs of VMDK images.
+const (
+	FormatSparse          = "http://www.vmware.com/interfaces/specifications/vmdk.html#sparse"
+	FormatStreamOptimized = "http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"
+)
+
+// ErrUnsupportedVersion is returned when parsing a document that is not an
+// OVF 1.0 or 2.0 envelope.
+var ErrUnsupportedVersion = errors.New("ovf: unsupported envelope")
+
+// prefixes maps well-known namespaces to the prefixes used in struct tags.
+// Items of OVF 2.0 are normalized to rasd.
+var prefixes = map[string]string{
+	NamespaceOVF1:  "ovf",
+	NamespaceOVF2:  "ovf",
+	NamespaceRASD:  "rasd",
+	NamespaceSASD:  "rasd",
+	NamespaceEPASD: "rasd",
+	NamespaceVSSD:  "vssd",
+	NamespaceVBox:  "vbox",
+	NamespaceXSI:   "xsi",
+	namespaceXML:   "xml",
+}
+
+// Envelope is the root element of an OVF descriptor. Only a single
+// VirtualSystem is supported.
+type Envelope struct {
+	XMLName    xml.Name        `xml:"Envelope"`
+	Version    string          `xml:"ovf:version,attr,omitempty"`
+	Lang       string          `xml:"xml:lang,attr,omitempty"`
+	Attrs      []xml.Attr      `xml:",any,attr"` // other attributes, e.g. extra namespace declarations
+	References []File          `xml:"References>File"`
+	Disks      *DiskSection    `xml:"DiskSection"`
+	Networks   *NetworkSection `xml:"NetworkSection"`
+	System     *VirtualSystem  `xml:"VirtualSystem"`
+}
+
+// File is an external file referenced by the descriptor.
+type File struct {
+	ID   string `xml:"ovf:id,attr"`
+	Href string `xml:"ovf:href,attr"`
+	Size int64  `xml:"ovf:size,attr,omitempty"`
+}
+
+// DiskSection lists the virtual disks of an appliance.
+type DiskSection struct {
+	Info  string        `xml:"Info"`
+	Disks []VirtualDisk `xml:"Disk"`
+}
+
+// VirtualDisk is a virtual disk, usually backed by a file in References.
+type VirtualDisk struct {
+	Capacity      string `xml:"ovf:capacity,attr"`
+	CapacityUnits string `xml:"ovf:capacityAllocationUnits,attr,omitempty"` // e.g. "byte * 2^30"; empty means bytes
+	ID            string `xml:"ovf:diskId,attr"`
+	FileRef       string `xml:"ovf:fileRef,attr,omitempty"`
+	Format        string `xml:"ovf:format,attr,omitempty"`
+	PopulatedSize int64  `xml:"ovf:populatedSize,attr,omitempty"`
+	UUID          string `xml:"vbox:uuid,attr,omitempty"`
+}
+
+// CapacityBytes returns the capacity of the disk in bytes.
+func (d VirtualDisk) CapacityBytes() (int64, error) {
+	n, err := strconv.ParseInt(d.Capacity, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ovf: disk %s: capacity: %v", d.ID, err)
+	}
+	unit, err := unitBytes(d.CapacityUnits)
+	if err != nil {
+		return 0, fmt.Errorf("ovf: disk %s: %v", d.ID, err)
+	}
+	return n * int64(unit), nil
+}
+
+// NetworkSection lists the logical networks of an appliance.
+type NetworkSection struct {
+	Info     string    `xml:"Info"`
+	Networks []Network `xml:"Network"`
+}
+
+// Network is a logical network the NICs of an appliance connect to.
+type Network struct {
+	Name        string `xml:"ovf:name,attr"`
+	Description string `xml:"Description,omitempty"`
+}
+
+// VirtualSystem describes a single virtual machine.
+type VirtualSystem struct {
+	ID              string                  `xml:"ovf:id,attr"`
+	Info            string                  `xml:"Info"`
+	Name            string                  `xml:"Name,omitempty"`
+	Product         *ProductSection         `xml:"ProductSection"`
+	OperatingSystem *OperatingSystemSection `xml:"OperatingSystemSection"`
+	Hardware        VirtualHardwareSection  `xml:"VirtualHardwareSection"`
+	Sections        []Node                  `xml:",any"` // other sections, e.g. vbox:Machine, kept as is
+}
+
+// ProductSection holds product metadata of a virtual system.
+type ProductSection struct {
+	Info       string `xml:"Info"`
+	Product    string `xml:"Product,omitempty"`
+	Vendor     string `xml:"Vendor,omitempty"`
+	Version    string `xml:"Version,omitempty"`
+	ProductURL string `xml:"ProductUrl,omitempty"`
+	VendorURL  string `xml:"VendorUrl,omitempty"`
+}
+
+// OperatingSystemSection describes the guest operating system.
+type OperatingSystemSection struct {
+	ID          int    `xml:"ovf:id,attr"`
+	Info        string `xml:"Info"`
+	Description string `xml:"Description,omitempty"`
+	OSType      string `xml:"vbox:OSType,omitempty"` // VirtualBox guest OS type
+}
+
+// Node is an XML element the package does not interpret.
+type Node struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Text    string     `xml:",chardata"`
+	Nodes   []Node     `xml:",any"`
+}
+
+// New returns an OVF 1.0 envelope with an empty virtual system of the given
+// name.
+func New(name string) *Envelope {
+	return &Envelope{
+		Version: "1.0",
+		Lang:    "en-US",
+		System: &VirtualSystem{
+			ID:   name,
+			Info: "A virtual machine",
+			Hardware: VirtualHardwareSection{
+				Info: "Virtual hardware requirements for a virtual machine",
+				System: &SystemSettings{
+					ElementName:             "Virtual Hardware Family",
+					InstanceID:              "0",
+					VirtualSystemIdentifier: name,
+					VirtualSystemType:       "virtualbox-2.2",
+				},
+			},
+		},
+	}
+}
+
+// Parse reads an OVF descriptor.
+func Parse(r io.Reader) (*Envelope, error) {
+	d := xml.NewTokenDecoder(&prefixReader{d: xml.NewDecoder(r), decls: map[string]string{}})
+	e := &Envelope{}
+	if err := d.Decode(e); err != nil {
+		if errors.Is(err, ErrUnsupportedVersion) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ovf: %w", err)
+	}
+	return e, nil
+}
+
+// ParseFile reads the OVF descriptor at path.
+func ParseFile(path string) (*Envelope, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Marshal returns the envelope as an XML document, declaring the namespaces
+// matching its version.
+func (e *Envelope) Marshal() ([]byte, error) {
+	out := *e
+	out.Attrs = []xml.Attr{
+		{Name: xml.Name{Local: "xmlns"}, Value: NamespaceOVF1},
+		{Name: xml.Name{Local: "xmlns:ovf"}, Value: NamespaceOVF1},
+		{Name: xml.Name{Local: "xmlns:rasd"}, Value: NamespaceRASD},
+		{Name: xml.Name{Local: "xmlns:vssd"}, Value: NamespaceVSSD},
+		{Name: xml.Name{Local: "xmlns:xsi"}, Value: NamespaceXSI},
+		{Name: xml.Name{Local: "xmlns:vbox"}, Value: NamespaceVBox},
+	}
+	if e.Version == "2.0" {
+		out.Attrs[0].Value, out.Attrs[1].Value = NamespaceOVF2, NamespaceOVF2
+		out.Attrs = append(out.Attrs,
+			xml.Attr{Name: xml.Name{Local: "xmlns:sasd"}, Value: NamespaceSASD},
+			xml.Attr{Name: xml.Name{Local: "xmlns:epasd"}, Value: NamespaceEPASD})
+		if e.System != nil {
+			sys := *e.System
+			sys.Hardware.version = e.Version
+			out.System = &sys
+		}
+	}
+	for _, a := range e.Attrs {
+		switch a.Name.Local {
+		case "xmlns", "xmlns:ovf", "xmlns:rasd", "xmlns:vssd", "xmlns:xsi", "xmlns:vbox", "xmlns:sasd", "xmlns:epasd":
+			continue
+		}
+		out.Attrs = append(out.Attrs, a)
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&out); err != nil {
+		return nil, fmt.Errorf("ovf: %w", err)
+	}
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// WriteFile writes the envelope to path.
+func (e *Envelope) WriteFile(path string) error {
+	b, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Disk returns the virtual disk with the given ID, or nil.
+func (e *Envelope) Disk(id string) *VirtualDisk {
+	if e.Disks == nil {
+		return nil
+	}
+	for i := range e.Disks.Disks {
+		if e.Disks.Disks[i].ID == id {
+			return &e.Disks.Disks[i]
+		}
+	}
+	return nil
+}
+
+// File returns the referenced file with the given ID, or nil.
+func (e *Envelope) File(id string) *File {
+	for i := range e.References {
+		if e.References[i].ID == id {
+			return &e.References[i]
+		}
+	}
+	return nil
+}
+
+// AddDisk adds a virtual disk of capacity bytes stored in the file href, in
+// the given format (e.g. FormatStreamOptimized), to the envelope. Attach it
+// to a controller with VirtualHardwareSection.AddAttachment.
+func (e *Envelope) AddDisk(id, href string, size, capacity int64, format string) *VirtualDisk {
+	fileID := fmt.Sprintf("file%d", len(e.References)+1)
+	e.References = append(e.References, File{ID: fileID, Href: href, Size: size})
+	if e.Disks == nil {
+		e.Disks = &DiskSection{Info: "List of the virtual disks used in the package"}
+	}
+	e.Disks.Disks = append(e.Disks.Disks, VirtualDisk{
+		Capacity: strconv.FormatInt(capacity, 10),
+		ID:       id,
+		FileRef:  fileID,
+		Format:   format,
+	})
+	return &e.Disks.Disks[len(e.Disks.Disks)-1]
+}
+
+// AddNetwork adds a logical network unless one of that name exists.
+func (e *Envelope) AddNetwork(name string) {
+	if e.Networks == nil {
+		e.Networks = &NetworkSection{Info: "Logical networks used in the package"}
+	}
+	for _, n := range e.Networks.Networks {
+		if n.Name == name {
+			return
+		}
+	}
+	e.Networks.Networks = append(e.Networks.Networks, Network{
+		Name:        name,
+		Description: "Logical network used by this appliance.",
+	})
+}
+
+// unitBytes returns the number of bytes in an OVF allocation unit such as
+// "byte * 2^20" or "MegaBytes". The empty string means bytes.
+func unitBytes(units string) (uint64, error) {
+	s := strings.ReplaceAll(units, " ", "")
+	switch strings.ToLower(s) {
+	case "", "byte", "bytes":
+		return 1, nil
+	case "kb", "kilobytes":
+		return 1 << 10, nil
+	case "mb", "megabytes":
+		return 1 << 20, nil
+	case "gb", "gigabytes":
+		return 1 << 30, nil
+	}
+	if exp, ok := strings.CutPrefix(s, "byte*2^"); ok {
+		n, err := strconv.ParseUint(exp, 10, 8)
+		if err == nil && n < 64 {
+			return 1 << n, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown allocation unit %q", units)
+}
+
+// prefixReader rewrites the namespaced names produced by an xml.Decoder to
+// the prefixed names used in struct tags, so a document decodes the same
+// regardless of the prefixes it declares.
+type prefixReader struct {
+	d     *xml.Decoder
+	decls map[string]string // namespace -> prefix declared in the document
+	root  bool
+}
+
+func (p *prefixReader) Token() (xml.Token, error) {
+	t, err := p.d.Token()
+	if err != nil {
+		return t, err
+	}
+	switch t := t.(type) {
+	case xml.StartElement:
+		if !p.root {
+			p.root = true
+			if t.Name.Local != "Envelope" || (t.Name.Space != NamespaceOVF1 && t.Name.Space != NamespaceOVF2) {
+				return nil, fmt.Errorf("%w: root element %s %s", ErrUnsupportedVersion, t.Name.Space, t.Name.Local)
+			}
+		}
+		attrs := t.Attr[:0:0]
+		for _, a := range t.Attr {
+			switch {
+			case a.Name.Space == "xmlns":
+				p.decls[a.Value] = a.Name.Local
+				a.Name = xml.Name{Local: "xmlns:" + a.Name.Local}
+			case a.Name.Space == "" && a.Name.Local == "xmlns":
+				continue // the default namespace is implied by the element names
+			default:
+				a.Name = p.rename(a.Name, true)
+			}
+			attrs = append(attrs, a)
+		}
+		t.Attr = attrs
+		t.Name = p.rename(t.Name, false)
+		return t, nil
+	case xml.EndElement:
+		t.Name = p.rename(t.Name, false)
+		return t, nil
+	case xml.CharData:
+		if len(bytes.TrimSpace(t)) == 0 {
+			// Drop indentation so it is not kept in Nodes.
+			return xml.CharData(nil), nil
+		}
+	}
+	return t, nil
+}
+
+// rename returns the prefixed local name of n. Elements of the OVF envelope
+// namespace are unprefixed, its attributes use ovf:.
+func (p *prefixReader) rename(n xml.Name, attr bool) xml.Name {
+	if n.Space == "" {
+		return n
+	}
+	prefix, ok := prefixes[n.Space]
+	if !ok {
+		prefix, ok = p.decls[n.Space]
+	}
+	if !ok {
+		prefix = n.Space // undeclared prefix
+	}
+	if prefix == "ovf" && !attr {
+		prefix = ""
+	}
+	switch n.Local {
+	case "StorageItem", "EthernetPortItem":
+		n.Local = "Item"
+	}
+	if prefix == "" {
+		return xml.Name{Local: n.Local}
+	}
+	return xml.Name{Local: prefix + ":" + n.Local}
+}
@@ -0,0 +1,212 @@
+package ovf
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	virtualbox "github.com/markmarine/go-virtualbox"
+)
+
+func TestParse(t *testing.T) {
+	e, err := ParseFile("testdata/builder.ovf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != "1.0" || e.System == nil || e.System.ID != "builder" {
+		t.Fatalf("got %+v", e)
+	}
+	disk := e.Disk("vmdisk1")
+	if disk == nil || disk.Format != FormatStreamOptimized || disk.UUID == "" {
+		t.Fatalf("disk: got %+v", disk)
+	}
+	if n, err := disk.CapacityBytes(); err != nil || n != 20<<30 {
+		t.Errorf("capacity: got %d, %v", n, err)
+	}
+	if f := e.File(disk.FileRef); f == nil || f.Href != "builder-disk001.vmdk" {
+		t.Errorf("file: got %+v", f)
+	}
+	if os := e.System.OperatingSystem; os == nil || os.ID != 94 || os.OSType != "Ubuntu_64" {
+		t.Errorf("os: got %+v", os)
+	}
+
+	h := &e.System.Hardware
+	if got := h.CPUs(); got != 2 {
+		t.Errorf("cpus: got %d", got)
+	}
+	if got, err := h.Memory(); err != nil || got != 2048 {
+		t.Errorf("memory: got %d, %v", got, err)
+	}
+	wantCtls := []Controller{
+		{"3", virtualbox.StorageController{SysBus: virtualbox.SysBusIDE, Chipset: virtualbox.CtrlPIIX4}},
+		{"4", virtualbox.StorageController{SysBus: virtualbox.SysBusSATA, Chipset: virtualbox.CtrlIntelAHCI}},
+	}
+	if got := h.StorageControllers(); !reflect.DeepEqual(got, wantCtls) {
+		t.Errorf("controllers: got %+v, want %+v", got, wantCtls)
+	}
+	wantAtts := []Attachment{
+		{"4", virtualbox.StorageMedium{Port: 0, DriveType: virtualbox.DriveHDD, Medium: "vmdisk1"}},
+		{"3", virtualbox.StorageMedium{Port: 1, Device: 1, DriveType: virtualbox.DriveDVD, Medium: "emptydrive"}},
+	}
+	if got := h.Attachments(); !reflect.DeepEqual(got, wantAtts) {
+		t.Errorf("attachments: got %+v, want %+v", got, wantAtts)
+	}
+	wantNICs := []virtualbox.NIC{{Network: virtualbox.NICNetNAT, Hardware: virtualbox.IntelPro1000MTDesktop}}
+	if got := h.NICs(); !reflect.DeepEqual(got, wantNICs) {
+		t.Errorf("nics: got %+v, want %+v", got, wantNICs)
+	}
+	if len(e.System.Sections) != 1 || e.System.Sections[0].XMLName.Local != "vbox:Machine" {
+		t.Errorf("sections: got %+v", e.System.Sections)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	e, err := ParseFile("testdata/builder.ovf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`xmlns="http://schemas.dmtf.org/ovf/envelope/1"`,
+		`<rasd:ResourceType>20</rasd:ResourceType>`,
+		`<vbox:Machine ovf:required="false"`,
+		`<Disk ovf:capacity="20" ovf:capacityAllocationUnits="byte * 2^30" ovf:diskId="vmdisk1"`,
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("output lacks %s", s)
+		}
+	}
+	again, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.System.Hardware, e.System.Hardware) {
+		t.Errorf("hardware changed in round trip:\n%+v\n%+v", again.System.Hardware, e.System.Hardware)
+	}
+}
+
+func TestMarshalRoundTrip20(t *testing.T) {
+	e, err := ParseFile("testdata/builder.ovf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Version = "2.0"
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`xmlns="http://schemas.dmtf.org/ovf/envelope/2"`,
+		`xmlns:sasd="` + NamespaceSASD + `"`,
+		`xmlns:epasd="` + NamespaceEPASD + `"`,
+		`<sasd:ResourceType>17</sasd:ResourceType>`,
+		`<epasd:ResourceType>10</epasd:ResourceType>`,
+		`<rasd:ResourceType>20</rasd:ResourceType>`,
+	} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("output lacks %s", s)
+		}
+	}
+	if n := bytes.Count(b, []byte("<StorageItem>")); n != 1 {
+		t.Errorf("got %d StorageItems, want 1", n)
+	}
+	if n := bytes.Count(b, []byte("<EthernetPortItem>")); n != 1 {
+		t.Errorf("got %d EthernetPortItems, want 1", n)
+	}
+	again, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Version != "2.0" || !reflect.DeepEqual(again.System.Hardware, e.System.Hardware) {
+		t.Errorf("hardware changed in round trip:\n%+v\n%+v", again.System.Hardware, e.System.Hardware)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	e := New("ci")
+	h := &e.System.Hardware
+	h.SetCPUs(4)
+	h.SetMemory(4096)
+	h.SetCPUs(2)
+	ctl, err := h.AddStorageController(virtualbox.StorageController{Chipset: virtualbox.CtrlIntelAHCI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.AddDisk("vmdisk1", "ci-disk1.vmdk", 1<<20, 8<<30, FormatStreamOptimized)
+	if _, err := h.AddAttachment(ctl, virtualbox.StorageMedium{DriveType: virtualbox.DriveHDD, Medium: "vmdisk1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddNIC(virtualbox.NIC{Network: virtualbox.NICNetBridged, Hardware: virtualbox.VirtIO}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.AddAttachment("42", virtualbox.StorageMedium{DriveType: virtualbox.DriveDVD}); err == nil {
+		t.Error("attached to a missing controller")
+	}
+
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gh := &got.System.Hardware
+	if mem, _ := gh.Memory(); gh.CPUs() != 2 || mem != 4096 {
+		t.Errorf("got %d CPUs and %d MB", gh.CPUs(), mem)
+	}
+	if atts := gh.Attachments(); len(atts) != 1 || atts[0].Controller != ctl || atts[0].Medium != "vmdisk1" {
+		t.Errorf("attachments: got %+v", atts)
+	}
+	if nics := gh.NICs(); len(nics) != 1 || nics[0].Network != virtualbox.NICNetBridged || nics[0].Hardware != virtualbox.VirtIO {
+		t.Errorf("nics: got %+v", nics)
+	}
+	if got.Networks == nil || len(got.Networks.Networks) != 1 || got.Networks.Networks[0].Name != "Bridged" {
+		t.Errorf("networks: got %+v", got.Networks)
+	}
+}
+
+func TestStorageControllersRoundTrip(t *testing.T) {
+	ctls := []virtualbox.StorageController{
+		{SysBus: virtualbox.SysBusIDE, Chipset: virtualbox.CtrlPIIX4},
+		{SysBus: virtualbox.SysBusSCSI, Chipset: virtualbox.CtrlLSILogic},
+		{SysBus: virtualbox.SysBusSAS, Chipset: virtualbox.CtrlLSILogicSAS},
+		{SysBus: virtualbox.SysBusSATA, Chipset: virtualbox.CtrlIntelAHCI},
+		{SysBus: virtualbox.SysBusPCIe, Chipset: virtualbox.CtrlNVMe},
+		{SysBus: virtualbox.SysBusVirtio, Chipset: virtualbox.CtrlVirtIO},
+		{SysBus: virtualbox.SysBusUSB, Chipset: virtualbox.CtrlUSB},
+	}
+	e := New("ci")
+	for _, ctl := range ctls {
+		if _, err := e.System.Hardware.AddStorageController(ctl); err != nil {
+			t.Fatalf("%s: %v", ctl.Chipset, err)
+		}
+	}
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotCtls []virtualbox.StorageController
+	for _, ctl := range got.System.Hardware.StorageControllers() {
+		gotCtls = append(gotCtls, ctl.StorageController)
+	}
+	if !reflect.DeepEqual(gotCtls, ctls) {
+		t.Errorf("got %+v, want %+v", gotCtls, ctls)
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<Envelope xmlns="http://www.vmware.com/schema/ovf/1/envelope"/>`))
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
@@ -3,8 +3,13 @@ package virtualbox
 import (
 	"fmt"
 	"net"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
+var reNATNetPFRule = regexp.MustCompile(`^([^:]+):(tcp|udp):\[([^\]]*)\]:(\d+):\[([^\]]*)\]:(\d+)$`)
+
 // PFRule represents a port forwarding rule.
 type PFRule struct {
 	Proto     PFProto
@@ -49,3 +54,64 @@ func (r PFRule) Format() string {
 	}
 	return fmt.Sprintf("%s,%s,%d,%s,%d", r.Proto, hostip, r.HostPort, guestip, r.GuestPort)
 }
+
+// parsePFRule parses a named rule in the "name,proto,hostip,hostport,guestip,guestport"
+// form VBoxManage prints.
+func parsePFRule(s string) (string, PFRule, error) {
+	f := strings.Split(s, ",")
+	if len(f) != 6 {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q", s)
+	}
+	hostPort, err := strconv.ParseUint(f[3], 10, 16)
+	if err != nil {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q: %v", s, err)
+	}
+	guestPort, err := strconv.ParseUint(f[5], 10, 16)
+	if err != nil {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q: %v", s, err)
+	}
+	return f[0], PFRule{
+		Proto:     PFProto(f[1]),
+		HostIP:    net.ParseIP(f[2]),
+		HostPort:  uint16(hostPort),
+		GuestIP:   net.ParseIP(f[4]),
+		GuestPort: uint16(guestPort),
+	}, nil
+}
+
+// formatNATNet returns the named rule in the "name:proto:[hostip]:hostport:[guestip]:guestport"
+// form NAT networks use.
+func (r PFRule) formatNATNet(name string) string {
+	hostip := ""
+	if r.HostIP != nil {
+		hostip = r.HostIP.String()
+	}
+	guestip := ""
+	if r.GuestIP != nil {
+		guestip = r.GuestIP.String()
+	}
+	return fmt.Sprintf("%s:%s:[%s]:%d:[%s]:%d", name, r.Proto, hostip, r.HostPort, guestip, r.GuestPort)
+}
+
+// parseNATNetPFRule parses a named rule in the form NAT networks use.
+func parseNATNetPFRule(s string) (string, PFRule, error) {
+	res := reNATNetPFRule.FindStringSubmatch(s)
+	if res == nil {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q", s)
+	}
+	hostPort, err := strconv.ParseUint(res[4], 10, 16)
+	if err != nil {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q: %v", s, err)
+	}
+	guestPort, err := strconv.ParseUint(res[6], 10, 16)
+	if err != nil {
+		return "", PFRule{}, fmt.Errorf("invalid port forwarding rule %q: %v", s, err)
+	}
+	return res[1], PFRule{
+		Proto:     PFProto(res[2]),
+		HostIP:    net.ParseIP(res[3]),
+		HostPort:  uint16(hostPort),
+		GuestIP:   net.ParseIP(res[5]),
+		GuestPort: uint16(guestPort),
+	}, nil
+}
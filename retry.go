@@ -0,0 +1,80 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries commands that failed because the
+// machine or one of its media was transiently locked or busy. Other failures,
+// such as ErrNotFound, are returned immediately.
+type RetryPolicy struct {
+	MaxAttempts int           // Total number of attempts; 0 or 1 disables retrying.
+	Delay       time.Duration // Delay before the first retry.
+	MaxDelay    time.Duration // Upper bound of the delay; 0 means unbounded.
+	Multiplier  float64       // Growth factor of the delay per retry; values below 1 mean 2.
+
+	// Retryable decides whether err is worth another attempt. Nil retries
+	// errors matching ErrSessionLocked or ErrBusy.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy retries for about five seconds in total.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 6,
+	Delay:       200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Multiplier:  2,
+}
+
+// IsTransient reports whether err is a VBoxManage failure that is likely to
+// succeed when retried, i.e. a machine or medium locked by another session.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrSessionLocked) || errors.Is(err, ErrBusy)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// backoff returns the delay before retry n, starting at 0.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	m := p.Multiplier
+	if m < 1 {
+		m = 2
+	}
+	d := float64(p.Delay)
+	for i := 0; i < n; i++ {
+		d *= m
+		if p.MaxDelay > 0 && d >= float64(p.MaxDelay) {
+			return p.MaxDelay
+		}
+	}
+	return time.Duration(d)
+}
+
+// retry calls f until it succeeds, fails permanently, ctx is done or the
+// client's retry policy is exhausted. f must be safe to call repeatedly.
+func (c *Client) retry(ctx context.Context, f func() error) error {
+	p := c.Retry
+	err := f()
+	if p == nil {
+		return err
+	}
+	for n := 0; err != nil && n+1 < p.MaxAttempts && p.retryable(err); n++ {
+		d := p.backoff(n)
+		if c.verbose() {
+			c.logger().Printf("retrying in %v: %v", d, err)
+		}
+		if serr := sleep(ctx, d); serr != nil {
+			return fmt.Errorf("%w (retry aborted: %w)", err, serr)
+		}
+		err = f()
+	}
+	return err
+}
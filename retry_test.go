@@ -0,0 +1,76 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryLocked(t *testing.T) {
+	attempts := 0
+	c := &Client{
+		Retry: &RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+		Executor: ExecFunc(func(ctx context.Context, cmd *Command) error {
+			attempts++
+			if attempts < 3 {
+				cmd.Stderr.Write([]byte(stderrLocked))
+				return exitStatus(1)
+			}
+			return nil
+		}),
+	}
+	if err := c.vbm(context.Background(), "modifyvm", "dev", "--memory", "512"); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts := 0
+	c := &Client{
+		Retry: &RetryPolicy{MaxAttempts: 2, Delay: time.Millisecond},
+		Executor: ExecFunc(func(ctx context.Context, cmd *Command) error {
+			attempts++
+			cmd.Stderr.Write([]byte(stderrLocked))
+			return exitStatus(1)
+		}),
+	}
+	err := c.vbm(context.Background(), "controlvm", "dev", "pause")
+	if !errors.Is(err, ErrSessionLocked) {
+		t.Fatalf("got %v, want ErrSessionLocked", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("got %d attempts, want 2", attempts)
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	attempts := 0
+	c := &Client{
+		Retry: DefaultRetryPolicy,
+		Executor: ExecFunc(func(ctx context.Context, cmd *Command) error {
+			attempts++
+			cmd.Stderr.Write([]byte(stderrNotFound))
+			return exitStatus(1)
+		}),
+	}
+	if _, err := c.vbmOut(context.Background(), "showvminfo", "nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for n, w := range want {
+		if got := p.backoff(n); got != w*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", n, got, w*time.Millisecond)
+		}
+	}
+}
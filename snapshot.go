@@ -0,0 +1,200 @@
+package virtualbox
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	reSnapshotKey   = regexp.MustCompile(`^Snapshot(Name|UUID|Description)((?:-\d+)*)$`)
+	reSnapshotState = regexp.MustCompile(`(?m)^State:\s+(.+?)\s+\(since ([^)]+)\)\s*$`)
+)
+
+// Snapshot is a node in the snapshot tree of a machine.
+type Snapshot struct {
+	Name        string
+	UUID        string
+	Description string
+	Current     bool      // the machine's current state is based on this snapshot
+	Online      bool      // taken while running, so it includes the execution state
+	TimeStamp   time.Time // zero if unknown
+	Parent      *Snapshot
+	Children    []*Snapshot
+}
+
+// Find returns the snapshot in the tree rooted at s with the given name or
+// UUID, or nil.
+func (s *Snapshot) Find(id string) *Snapshot {
+	if s == nil {
+		return nil
+	}
+	if s.Name == id || s.UUID == id {
+		return s
+	}
+	for _, c := range s.Children {
+		if f := c.Find(id); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// Walk calls fn for s and all its descendants, parents before children.
+func (s *Snapshot) Walk(fn func(*Snapshot)) {
+	if s == nil {
+		return
+	}
+	fn(s)
+	for _, c := range s.Children {
+		c.Walk(fn)
+	}
+}
+
+// parseSnapshots builds the snapshot tree from the hierarchically numbered
+// SnapshotName-1-2 style keys of machine-readable output.
+func parseSnapshots(kvs []keyValue) *Snapshot {
+	nodes := map[string]*Snapshot{}
+	var current string
+	for _, kv := range kvs {
+		if kv.key == "CurrentSnapshotUUID" {
+			current = kv.val
+			continue
+		}
+		res := reSnapshotKey.FindStringSubmatch(kv.key)
+		if res == nil {
+			continue
+		}
+		path := res[2]
+		s := nodes[path]
+		if s == nil {
+			s = &Snapshot{}
+			nodes[path] = s
+			if path != "" {
+				parent := nodes[path[:strings.LastIndex(path, "-")]]
+				if parent == nil {
+					continue // orphan, should not happen
+				}
+				s.Parent = parent
+				parent.Children = append(parent.Children, s)
+			}
+		}
+		switch res[1] {
+		case "Name":
+			s.Name = kv.val
+		case "UUID":
+			s.UUID = kv.val
+		case "Description":
+			s.Description = kv.val
+		}
+	}
+	root := nodes[""]
+	root.Walk(func(s *Snapshot) {
+		s.Current = current != "" && s.UUID == current
+	})
+	return root
+}
+
+// parseSnapshotState returns the online flag and time stamp of a snapshot
+// from the output of "snapshot <vm> showvminfo <snapshot>". The state of the
+// snapshot's machine is saved if it was taken while running, and it changed
+// to that state when the snapshot was taken.
+func parseSnapshotState(out string) (online bool, ts time.Time) {
+	res := reSnapshotState.FindStringSubmatch(out)
+	if res == nil {
+		return false, time.Time{}
+	}
+	online = strings.HasSuffix(res[1], "saved") // saved or aborted-saved
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, res[2]); err == nil {
+			return online, t
+		}
+	}
+	return online, time.Time{}
+}
+
+// TakeSnapshot takes a snapshot of the machine. If live is set, a running
+// machine keeps running while the snapshot is taken.
+func (m *machine) TakeSnapshot(ctx context.Context, name, description string, live bool) error {
+	args := []string{"snapshot", m.name, "take", name}
+	if description != "" {
+		args = append(args, "--description", description)
+	}
+	if live {
+		args = append(args, "--live")
+	}
+	if err := m.client.vbm(ctx, args...); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// RestoreSnapshot restores the snapshot with the given name or UUID. The
+// machine must not be running.
+func (m *machine) RestoreSnapshot(ctx context.Context, id string) error {
+	if err := m.client.vbm(ctx, "snapshot", m.name, "restore", id); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// RestoreCurrent restores the current snapshot, discarding all changes made
+// since it was taken. The machine must not be running.
+func (m *machine) RestoreCurrent(ctx context.Context) error {
+	if err := m.client.vbm(ctx, "snapshot", m.name, "restorecurrent"); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// DeleteSnapshot deletes the snapshot with the given name or UUID, merging
+// its differencing images into their children.
+func (m *machine) DeleteSnapshot(ctx context.Context, id string) error {
+	if err := m.client.vbm(ctx, "snapshot", m.name, "delete", id); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// EditSnapshot renames the snapshot with the given name or UUID and changes
+// its description. Empty values are left unchanged.
+func (m *machine) EditSnapshot(ctx context.Context, id, name, description string) error {
+	args := []string{"snapshot", m.name, "edit", id}
+	if name != "" {
+		args = append(args, "--name", name)
+	}
+	if description != "" {
+		args = append(args, "--description", description)
+	}
+	if len(args) == 4 {
+		return nil
+	}
+	if err := m.client.vbm(ctx, args...); err != nil {
+		return err
+	}
+	return m.Refresh(ctx)
+}
+
+// ListSnapshots returns the root of the machine's snapshot tree, or nil if
+// the machine has no snapshots. The online flags and time stamps take one
+// VBoxManage call per snapshot.
+func (m *machine) ListSnapshots(ctx context.Context) (*Snapshot, error) {
+	if err := m.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	root := m.Info().Snapshot
+	var err error
+	root.Walk(func(s *Snapshot) {
+		if err != nil {
+			return
+		}
+		var out string
+		out, err = m.client.vbmOut(ctx, "snapshot", m.name, "showvminfo", s.UUID)
+		s.Online, s.TimeStamp = parseSnapshotState(out)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
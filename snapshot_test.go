@@ -0,0 +1,89 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSnapshots(t *testing.T) {
+	root := parseSnapshots(parseMachineReadable(readFixture(t, "showvminfo.txt")))
+	if root == nil || root.Name != "clean install" || root.Description != "Fresh OS, no packages" {
+		t.Fatalf("root = %+v", root)
+	}
+	var names []string
+	root.Walk(func(s *Snapshot) { names = append(names, s.Name) })
+	if want := []string{"clean install", "toolchain", "toolchain running", "experiment"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+	cur := root.Find("11111111-aaaa-4bbb-8ccc-000000000003")
+	if cur == nil || !cur.Current || cur.Parent.Name != "toolchain" || cur.Parent.Parent != root {
+		t.Errorf("current snapshot = %+v", cur)
+	}
+	if root.Find("experiment").Current {
+		t.Error("experiment is marked current")
+	}
+	if parseSnapshots(parseMachineReadable(`name="x"`)) != nil {
+		t.Error("machine without snapshots has a snapshot tree")
+	}
+}
+
+func TestParseSnapshotState(t *testing.T) {
+	for _, tt := range []struct {
+		out    string
+		online bool
+		ts     time.Time
+	}{
+		{
+			out: "Name:                        builder\nState:                       powered off (since 2021-01-02T03:04:05.000000000Z)\n",
+			ts:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			out:    "State:           saved (since 2021-01-04T03:04:05.250000000)\nMonitor count:   1\n",
+			online: true,
+			ts:     time.Date(2021, 1, 4, 3, 4, 5, 250000000, time.UTC),
+		},
+		{out: "Name: builder\n"},
+	} {
+		online, ts := parseSnapshotState(tt.out)
+		if online != tt.online || !ts.Equal(tt.ts) {
+			t.Errorf("%q: got %v, %v, want %v, %v", tt.out, online, ts, tt.online, tt.ts)
+		}
+	}
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	f := newFakeVBM()
+	f.stdout["showvminfo builder --machinereadable"] = readFixture(t, "showvminfo.txt")
+	ctx := context.Background()
+	m, err := f.client().getMachine(ctx, "builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.TakeSnapshot(ctx, "before upgrade", "apt upgrade", true); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"snapshot", "builder", "take", "before upgrade", "--description", "apt upgrade", "--live"}
+	if !reflect.DeepEqual(f.calls[1], want) {
+		t.Errorf("got %q, want %q", f.calls[1], want)
+	}
+	f.stdout["snapshot builder showvminfo 11111111-aaaa-4bbb-8ccc-000000000003"] =
+		"State:                       saved (since 2021-01-04T03:04:05.000000000Z)\n"
+	root, err := m.ListSnapshots(ctx)
+	if err != nil || root.Name != "clean install" {
+		t.Fatalf("got %+v, %v", root, err)
+	}
+	if s := root.Find("toolchain running"); !s.Online || !s.TimeStamp.Equal(time.Date(2021, 1, 4, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("%q = %+v", s.Name, s)
+	}
+	if root.Online {
+		t.Errorf("%q is online", root.Name)
+	}
+
+	f.errs["snapshot builder showvminfo 11111111-aaaa-4bbb-8ccc-000000000002"] = errors.New("exit status 1")
+	if _, err := m.ListSnapshots(ctx); err == nil {
+		t.Error("ListSnapshots ignored a showvminfo error")
+	}
+}
@@ -0,0 +1,179 @@
+package virtualbox
+
+import "fmt"
+
+// MachineState is the execution state of a machine, as reported in the
+// VMState field of `VBoxManage showvminfo --machinereadable`.
+type MachineState string
+
+const (
+	Poweroff                   = MachineState("poweroff")
+	Saved                      = MachineState("saved")
+	Teleported                 = MachineState("teleported")
+	Aborted                    = MachineState("aborted")
+	AbortedSaved               = MachineState("aborted-saved")
+	Running                    = MachineState("running")
+	Paused                     = MachineState("paused")
+	GuruMeditation             = MachineState("gurumeditation")
+	Teleporting                = MachineState("teleporting")
+	LiveSnapshotting           = MachineState("livesnapshotting")
+	Starting                   = MachineState("starting")
+	Stopping                   = MachineState("stopping")
+	Saving                     = MachineState("saving")
+	Restoring                  = MachineState("restoring")
+	TeleportingPausedVM        = MachineState("teleportingpausedvm")
+	TeleportingIn              = MachineState("teleportingin")
+	DeletingSnapshotLive       = MachineState("deletingsnapshotlive")
+	DeletingSnapshotLivePaused = MachineState("deletingsnapshotlivepaused")
+	OnlineSnapshotting         = MachineState("onlinesnapshotting")
+	RestoringSnapshot          = MachineState("restoringsnapshot")
+	DeletingSnapshot           = MachineState("deletingsnapshot")
+	SettingUp                  = MachineState("settingup")
+	Snapshotting               = MachineState("snapshotting")
+)
+
+// stateClass describes which groups a state belongs to, mirroring the
+// FirstOnline/LastOnline and FirstTransient/LastTransient ranges of the
+// VirtualBox MachineState enum.
+type stateClass struct {
+	online    bool
+	transient bool
+}
+
+var stateClasses = map[MachineState]stateClass{
+	Poweroff:                   {},
+	Saved:                      {},
+	Teleported:                 {},
+	Aborted:                    {},
+	AbortedSaved:               {},
+	Running:                    {online: true},
+	Paused:                     {online: true},
+	GuruMeditation:             {online: true},
+	Teleporting:                {online: true, transient: true},
+	LiveSnapshotting:           {online: true, transient: true},
+	Starting:                   {online: true, transient: true},
+	Stopping:                   {online: true, transient: true},
+	Saving:                     {online: true, transient: true},
+	Restoring:                  {online: true, transient: true},
+	TeleportingPausedVM:        {online: true, transient: true},
+	TeleportingIn:              {online: true, transient: true},
+	DeletingSnapshotLive:       {online: true, transient: true},
+	DeletingSnapshotLivePaused: {online: true, transient: true},
+	OnlineSnapshotting:         {online: true, transient: true},
+	RestoringSnapshot:          {transient: true},
+	DeletingSnapshot:           {transient: true},
+	SettingUp:                  {transient: true},
+	Snapshotting:               {transient: true},
+}
+
+// IsKnown reports whether s is one of the states defined by VirtualBox.
+func (s MachineState) IsKnown() bool {
+	_, ok := stateClasses[s]
+	return ok
+}
+
+// IsOnline reports whether the machine has a running VM process, i.e. it is
+// running, paused, stuck or in a transient state of a running machine.
+func (s MachineState) IsOnline() bool {
+	return stateClasses[s].online
+}
+
+// IsTransient reports whether the machine is in the middle of a state change
+// and will move to another state on its own.
+func (s MachineState) IsTransient() bool {
+	return stateClasses[s].transient
+}
+
+// Operation is a state change that can be requested on a machine.
+type Operation string
+
+const (
+	OpStart    = Operation("start")
+	OpSave     = Operation("save")
+	OpPause    = Operation("pause")
+	OpStop     = Operation("stop")
+	OpPoweroff = Operation("poweroff")
+	OpRestart  = Operation("restart")
+	OpReset    = Operation("reset")
+)
+
+// transition says how an operation proceeds from a given state.
+type transition int
+
+const (
+	illegal    transition = iota
+	noop                  // already in the requested state
+	direct                // issue the command right away
+	startFirst            // start or resume the machine first
+)
+
+// transitions lists for every operation the states it may be requested in.
+// States missing from an operation's entry are illegal.
+var transitions = map[Operation]map[MachineState]transition{
+	OpStart: {
+		Poweroff: direct, Saved: direct, Aborted: direct, AbortedSaved: direct,
+		Teleported: direct, Paused: direct, Running: noop,
+	},
+	OpSave: {
+		Running: direct, Paused: startFirst,
+		Poweroff: noop, Saved: noop, Aborted: noop, AbortedSaved: noop, Teleported: noop,
+	},
+	OpPause: {
+		Running: direct, Paused: noop,
+		Poweroff: noop, Saved: noop, Aborted: noop, AbortedSaved: noop, Teleported: noop,
+	},
+	OpStop: {
+		Running: direct, Paused: startFirst, Stopping: direct,
+		Poweroff: noop, Saved: noop, Aborted: noop, AbortedSaved: noop, Teleported: noop,
+	},
+	OpPoweroff: {
+		Running: direct, Paused: direct, GuruMeditation: direct,
+		Starting: direct, Stopping: direct, Saving: direct, Restoring: direct,
+		Teleporting: direct, TeleportingPausedVM: direct, TeleportingIn: direct,
+		LiveSnapshotting: direct, OnlineSnapshotting: direct,
+		DeletingSnapshotLive: direct, DeletingSnapshotLivePaused: direct,
+		Poweroff: noop, Saved: noop, Aborted: noop, AbortedSaved: noop, Teleported: noop,
+	},
+	OpRestart: {
+		Running: direct, Paused: startFirst, Saved: startFirst,
+		Poweroff: direct, Aborted: direct, AbortedSaved: direct, Teleported: direct,
+	},
+	OpReset: {
+		Running: direct, Paused: startFirst, Saved: startFirst,
+	},
+}
+
+// Allows reports whether op may be requested while the machine is in state s.
+func (s MachineState) Allows(op Operation) bool {
+	return transitions[op][s] != illegal
+}
+
+// StateTransitionError is returned when an operation is requested while the
+// machine is in a state that does not allow it. It matches ErrInvalidState.
+type StateTransitionError struct {
+	Machine string
+	State   MachineState
+	Op      Operation
+}
+
+func (e *StateTransitionError) Error() string {
+	what := "is"
+	if !e.State.IsKnown() {
+		what = "is in unknown state"
+	}
+	return fmt.Sprintf("cannot %s machine %s: it %s %s", e.Op, e.Machine, what, e.State)
+}
+
+// Is makes errors.Is(err, ErrInvalidState) hold.
+func (e *StateTransitionError) Is(target error) bool {
+	return target == ErrInvalidState
+}
+
+// transition looks up how op proceeds from the machine's current state.
+func (m *machine) transition(op Operation) (transition, error) {
+	t := transitions[op][m.state]
+	if t == illegal {
+		return illegal, &StateTransitionError{Machine: m.name, State: m.state, Op: op}
+	}
+	return t, nil
+}
@@ -0,0 +1,84 @@
+package virtualbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMachineStatePredicates(t *testing.T) {
+	tests := []struct {
+		state             MachineState
+		online, transient bool
+	}{
+		{Poweroff, false, false},
+		{Running, true, false},
+		{GuruMeditation, true, false},
+		{Starting, true, true},
+		{Saving, true, true},
+		{DeletingSnapshot, false, true},
+		{AbortedSaved, false, false},
+	}
+	for _, tt := range tests {
+		if !tt.state.IsKnown() {
+			t.Errorf("%s is not known", tt.state)
+		}
+		if got := tt.state.IsOnline(); got != tt.online {
+			t.Errorf("%s.IsOnline() = %v", tt.state, got)
+		}
+		if got := tt.state.IsTransient(); got != tt.transient {
+			t.Errorf("%s.IsTransient() = %v", tt.state, got)
+		}
+	}
+	if MachineState("bogus").IsKnown() {
+		t.Error("bogus state is known")
+	}
+}
+
+func TestIllegalTransition(t *testing.T) {
+	f := newFakeVBM()
+	m := &machine{client: f.client(), name: "dev", state: Starting}
+	err := m.Start(context.Background())
+	if !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want ErrInvalidState", err)
+	}
+	if want := "cannot start machine dev: it is starting"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if len(f.calls) != 0 {
+		t.Errorf("unexpected commands %q", f.calls)
+	}
+
+	m.state = "bogus"
+	if err := m.Pause(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown state bogus") {
+		t.Errorf("got %v, want unknown state error", err)
+	}
+	m.state = Poweroff
+	if err := m.Reset(context.Background()); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("got %v, want ErrInvalidState", err)
+	}
+	if err := m.Pause(context.Background()); err != nil {
+		t.Errorf("pausing a powered off machine: %v", err)
+	}
+}
+
+func TestRestartFromSaved(t *testing.T) {
+	var cmds []string
+	c := stateSequence(Running, Poweroff)
+	exec := c.Executor
+	c.Executor = ExecFunc(func(ctx context.Context, cmd *Command) error {
+		if cmd.Args[0] != "showvminfo" {
+			cmds = append(cmds, strings.Join(cmd.Args, " "))
+		}
+		return exec.Exec(ctx, cmd)
+	})
+	m := &machine{client: c, name: "dev", state: Saved}
+	if err := m.Restart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "startvm dev --type headless|controlvm dev acpipowerbutton|startvm dev --type headless"
+	if got := strings.Join(cmds, "|"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,9 +1,19 @@
 package virtualbox
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidStorageCtl is returned by AddStorageCtl for controllers whose bus,
+// chipset and port count do not fit together.
+var ErrInvalidStorageCtl = errors.New("invalid storage controller")
+
 // StorageController represents a virtualized storage controller.
 type StorageController struct {
 	SysBus      SystemBus
-	Ports       uint // SATA port count 1--30
+	Ports       uint // port count, at most SysBus.MaxPorts()
 	Chipset     StorageControllerChipset
 	HostIOCache bool
 	Bootable    bool
@@ -17,8 +27,30 @@ const (
 	SysBusSATA   = SystemBus("sata")
 	SysBusSCSI   = SystemBus("scsi")
 	SysBusFloppy = SystemBus("floppy")
+	SysBusSAS    = SystemBus("sas")
+	SysBusPCIe   = SystemBus("pcie")   // NVMe
+	SysBusVirtio = SystemBus("virtio") // virtio-scsi
+	SysBusUSB    = SystemBus("usb")
 )
 
+// maxPorts is the highest port count of storage controllers on each bus.
+var maxPorts = map[SystemBus]uint{
+	SysBusIDE:    2,
+	SysBusSATA:   30,
+	SysBusSCSI:   16,
+	SysBusFloppy: 1,
+	SysBusSAS:    255,
+	SysBusPCIe:   255,
+	SysBusVirtio: 256,
+	SysBusUSB:    8,
+}
+
+// MaxPorts returns the highest port count of storage controllers on the bus,
+// or 0 if the bus is unknown.
+func (b SystemBus) MaxPorts() uint {
+	return maxPorts[b]
+}
+
 // StorageControllerChipset represents the hardware of a storage controller.
 type StorageControllerChipset string
 
@@ -31,14 +63,116 @@ const (
 	CtrlPIIX4       = StorageControllerChipset("PIIX4")
 	CtrlICH6        = StorageControllerChipset("ICH6")
 	CtrlI82078      = StorageControllerChipset("I82078")
+	CtrlNVMe        = StorageControllerChipset("NVMe")
+	CtrlVirtIO      = StorageControllerChipset("VirtIO")
+	CtrlUSB         = StorageControllerChipset("USB")
 )
 
+// chipsetBus maps storage controller chipsets to the system bus they sit on.
+var chipsetBus = map[StorageControllerChipset]SystemBus{
+	CtrlLSILogic:    SysBusSCSI,
+	CtrlLSILogicSAS: SysBusSAS,
+	CtrlBusLogic:    SysBusSCSI,
+	CtrlIntelAHCI:   SysBusSATA,
+	CtrlPIIX3:       SysBusIDE,
+	CtrlPIIX4:       SysBusIDE,
+	CtrlICH6:        SysBusIDE,
+	CtrlI82078:      SysBusFloppy,
+	CtrlNVMe:        SysBusPCIe,
+	CtrlVirtIO:      SysBusVirtio,
+	CtrlUSB:         SysBusUSB,
+}
+
+// validate checks that the bus, chipset and port count of the controller fit
+// together. Unset fields are left for VirtualBox to choose.
+func (ctl StorageController) validate() error {
+	bus := ctl.SysBus
+	if want, ok := chipsetBus[ctl.Chipset]; ok {
+		if bus != "" && bus != want {
+			return fmt.Errorf("%w: %s controllers sit on the %s bus, not %s", ErrInvalidStorageCtl, ctl.Chipset, want, bus)
+		}
+		bus = want
+	}
+	if bus == "" {
+		return nil
+	}
+	max := bus.MaxPorts()
+	if max == 0 {
+		return fmt.Errorf("%w: unknown bus %q", ErrInvalidStorageCtl, bus)
+	}
+	if ctl.Ports > max {
+		return fmt.Errorf("%w: %d ports on the %s bus, at most %d", ErrInvalidStorageCtl, ctl.Ports, bus, max)
+	}
+	return nil
+}
+
+// parseChipset maps a controller type as printed by VBoxManage (e.g.
+// "IntelAhci") to the matching chipset constant.
+func parseChipset(s string) StorageControllerChipset {
+	if strings.EqualFold(s, "VirtioSCSI") {
+		return CtrlVirtIO
+	}
+	for _, c := range []StorageControllerChipset{
+		CtrlLSILogic, CtrlLSILogicSAS, CtrlBusLogic, CtrlIntelAHCI,
+		CtrlPIIX3, CtrlPIIX4, CtrlICH6, CtrlI82078,
+		CtrlNVMe, CtrlVirtIO, CtrlUSB,
+	} {
+		if strings.EqualFold(s, string(c)) {
+			return c
+		}
+	}
+	return StorageControllerChipset(s)
+}
+
 // StorageMedium represents the storage medium attached to a storage controller.
 type StorageMedium struct {
 	Port      uint
 	Device    uint
 	DriveType DriveType
 	Medium    string // none|emptydrive|<uuid>|<filename|host:<drive>|iscsi
+
+	// The remaining options are only passed when set. The flags are passed
+	// as on or off when not nil, so they can also turn a setting off.
+	MType         MediumType // how the attached medium behaves with snapshots
+	Hotpluggable  *bool      // the drive may be attached and detached while running
+	NonRotational *bool      // report the drive to the guest as an SSD
+	Discard       *bool      // pass TRIM requests from the guest to the image
+	Passthrough   *bool      // give the guest direct access to a host DVD drive
+	TempEject     *bool      // let the guest eject the DVD until the machine stops
+	ForceUnmount  bool       // replace a DVD or floppy even if the guest locked it
+}
+
+// args returns the storageattach options for the medium.
+func (sm StorageMedium) args() []string {
+	args := []string{
+		"--port", fmt.Sprintf("%d", sm.Port),
+		"--device", fmt.Sprintf("%d", sm.Device),
+	}
+	if sm.DriveType != "" {
+		args = append(args, "--type", string(sm.DriveType))
+	}
+	args = append(args, "--medium", sm.Medium)
+	if sm.MType != "" {
+		args = append(args, "--mtype", string(sm.MType))
+	}
+	for _, o := range []struct {
+		name string
+		val  *bool
+	}{
+		{"--hotpluggable", sm.Hotpluggable},
+		{"--nonrotational", sm.NonRotational},
+		{"--discard", sm.Discard},
+		{"--passthrough", sm.Passthrough},
+		{"--tempeject", sm.TempEject},
+	} {
+		if o.val != nil {
+			args = append(args, o.name, bool2string(*o.val))
+		}
+	}
+	if sm.ForceUnmount {
+		args = append(args, "--forceunmount")
+	}
+	return args
 }
 
 // DriveType represents the hardware type of a drive.
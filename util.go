@@ -1,6 +1,10 @@
 package virtualbox
 
-import "net"
+import (
+	"context"
+	"net"
+	"time"
+)
 
 // ParseIPv4Mask parses IPv4 netmask written in IP form (e.g. 255.255.255.0).
 // This function should really belong to the net package.
@@ -11,3 +15,15 @@ func ParseIPv4Mask(s string) net.IPMask {
 	}
 	return net.IPv4Mask(mask[12], mask[13], mask[14], mask[15])
 }
+
+// sleep pauses for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -2,19 +2,25 @@ package virtualbox
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	VBM     string // Path to VBoxManage utility.
-	Verbose bool   // Verbose mode.
+	VBM     string // Path to VBoxManage utility used by clients that do not set their own.
+	Verbose bool   // Verbose mode for all clients.
 )
 
 func init() {
@@ -26,9 +32,10 @@ func init() {
 
 var (
 	reVMNameUUID      = regexp.MustCompile(`"(.+)" {([0-9a-f-]+)}`)
-	reVMInfoLine      = regexp.MustCompile(`(?:"(.+)"|(.+))=(?:"(.*)"|(.*))`)
 	reColonLine       = regexp.MustCompile(`(.+):\s+(.*)`)
 	reMachineNotFound = regexp.MustCompile(`Could not find a registered machine named '(.+)'`)
+	reVersion         = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+	reHostOS          = regexp.MustCompile(`(?m)^Operating system:\s*(.+)$`)
 )
 
 var (
@@ -37,52 +44,212 @@ var (
 	ErrVBMNotFound     = errors.New("VBoxManage not found")
 )
 
-func vbm(args ...string) error {
-	cmd := exec.Command(VBM, args...)
-	if Verbose {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		log.Printf("executing: %v %v", VBM, strings.Join(args, " "))
+// Client talks to one VirtualBox installation through its VBoxManage
+// utility. The zero value is ready to use and falls back to the package-level
+// VBM and Verbose settings. A Client is safe for concurrent use as long as its
+// fields are not modified.
+type Client struct {
+	VBM      string       // Path to VBoxManage. Empty means the package-level VBM.
+	Env      []string     // Extra environment variables in "key=value" form.
+	Verbose  bool         // Log every command and echo its output.
+	Logger   *log.Logger  // Destination of verbose output. Nil means the standard logger.
+	Executor Executor     // Runs the commands. Nil means LocalExecutor.
+	Retry    *RetryPolicy // Retries transient failures. Nil means no retries.
+
+	// PollInterval is how often machine states are polled while waiting
+	// for or watching them. Zero means one second.
+	PollInterval time.Duration
+
+	// Facts about the VBoxManage at infoPath, read once.
+	infoMu   sync.Mutex
+	infoPath string
+	version  string // output of --version
+	host     string // operating system of the VirtualBox host
+}
+
+// DefaultClient is the Client used by the package-level functions.
+var DefaultClient = &Client{}
+
+// NewClient returns a Client that runs the VBoxManage executable at path.
+func NewClient(path string) *Client {
+	return &Client{VBM: path}
+}
+
+// orDefault returns c, or DefaultClient if c is nil.
+func (c *Client) orDefault() *Client {
+	if c == nil {
+		return DefaultClient
 	}
-	if err := cmd.Run(); err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			return ErrVBMNotFound
-		}
-		return err
+	return c
+}
+
+func (c *Client) path() string {
+	if c.VBM != "" {
+		return c.VBM
 	}
-	return nil
+	return VBM
 }
 
-func vbmOut(args ...string) (string, error) {
-	cmd := exec.Command(VBM, args...)
-	if Verbose {
-		cmd.Stderr = os.Stderr
-		log.Printf("executing: %v %v", VBM, strings.Join(args, " "))
+func (c *Client) verbose() bool {
+	return c.Verbose || Verbose
+}
+
+func (c *Client) logger() *log.Logger {
+	if c.Logger != nil {
+		return c.Logger
 	}
+	return log.Default()
+}
 
-	b, err := cmd.Output()
-	if err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			err = ErrVBMNotFound
-		}
+func (c *Client) pollInterval() time.Duration {
+	if c.PollInterval > 0 {
+		return c.PollInterval
 	}
-	return string(b), err
+	return 1 * time.Second
 }
 
-func vbmOutErr(args ...string) (string, string, error) {
-	cmd := exec.Command(VBM, args...)
-	if Verbose {
-		log.Printf("executing: %v %v", VBM, strings.Join(args, " "))
+func (c *Client) executor() Executor {
+	if c.Executor != nil {
+		return c.Executor
 	}
-	var stdout bytes.Buffer
+	return LocalExecutor{}
+}
+
+// command prepares a VBoxManage command with the client's settings.
+func (c *Client) command(args ...string) *Command {
+	cmd := &Command{Path: c.path(), Args: args, Env: c.Env}
+	if c.verbose() {
+		c.logger().Printf("executing: %v %v", cmd.Path, strings.Join(args, " "))
+	}
+	return cmd
+}
+
+// run executes cmd and translates its error. A missing executable becomes
+// ErrVBMNotFound, and a failure caused by ctx wraps the context error so that
+// errors.Is(err, context.DeadlineExceeded) and errors.Is(err,
+// context.Canceled) hold. Any other failure is reported as a *VBoxError.
+func (c *Client) run(ctx context.Context, cmd *Command) error {
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
-	if err != nil {
-		if ee, ok := err.(*exec.Error); ok && ee == exec.ErrNotFound {
-			err = ErrVBMNotFound
+	if cmd.Stderr == nil {
+		cmd.Stderr = &stderr
+	} else {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+	}
+	err := c.executor().Exec(ctx, cmd)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return ErrVBMNotFound
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%s %s: %w", cmd.Path, strings.Join(cmd.Args, " "), ctxErr)
+	}
+	return newVBoxError(cmd.Args, stderr.String(), err)
+}
+
+// tee additionally copies w to the verbose output, if enabled.
+func (c *Client) tee(w io.Writer) io.Writer {
+	if !c.verbose() {
+		return w
+	}
+	if w == nil {
+		return c.logger().Writer()
+	}
+	return io.MultiWriter(w, c.logger().Writer())
+}
+
+// Version returns the VirtualBox version, e.g. "7.0.10r158379".
+func Version(ctx context.Context) (string, error) {
+	return DefaultClient.Version(ctx)
+}
+
+// Version returns the VirtualBox version, e.g. "7.0.10r158379". It is read
+// once and cached until the path to VBoxManage changes.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	return c.cachedInfo(ctx, &c.version, func(ctx context.Context) (string, error) {
+		out, err := c.vbmOut(ctx, "--version")
+		if err != nil {
+			return "", err
 		}
+		return strings.TrimSpace(out), nil
+	})
+}
+
+// hostOS returns the operating system of the VirtualBox host as reported by
+// `VBoxManage list hostinfo`, e.g. "Darwin" or "Linux". It is cached like
+// the version.
+func (c *Client) hostOS(ctx context.Context) (string, error) {
+	return c.cachedInfo(ctx, &c.host, func(ctx context.Context) (string, error) {
+		out, err := c.vbmOut(ctx, "list", "hostinfo")
+		if err != nil {
+			return "", err
+		}
+		res := reHostOS.FindStringSubmatch(out)
+		if res == nil {
+			return "", errors.New("host operating system not found in host info")
+		}
+		return strings.TrimSpace(res[1]), nil
+	})
+}
+
+// cachedInfo returns the cached fact in field, or reads it with probe and
+// caches it. VBoxManage runs without holding c.infoMu, so a slow probe does
+// not block other callers; concurrent first calls may both probe.
+func (c *Client) cachedInfo(ctx context.Context, field *string, probe func(context.Context) (string, error)) (string, error) {
+	c.infoMu.Lock()
+	if path := c.path(); c.infoPath != path {
+		c.infoPath, c.version, c.host = path, "", ""
+	}
+	path, v := c.infoPath, *field
+	c.infoMu.Unlock()
+	if v != "" {
+		return v, nil
 	}
-	return stdout.String(), stderr.String(), err
+	v, err := probe(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.infoMu.Lock()
+	if c.infoPath == path {
+		*field = v
+	}
+	c.infoMu.Unlock()
+	return v, nil
+}
+
+// majorVersion returns the major VirtualBox version.
+func (c *Client) majorVersion(ctx context.Context) (int, error) {
+	v, err := c.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res := reVersion.FindStringSubmatch(v)
+	if res == nil {
+		return 0, fmt.Errorf("unrecognized VirtualBox version %q", v)
+	}
+	return strconv.Atoi(res[1])
+}
+
+func (c *Client) vbm(ctx context.Context, args ...string) error {
+	return c.retry(ctx, func() error {
+		cmd := c.command(args...)
+		cmd.Stdout = c.tee(nil)
+		cmd.Stderr = c.tee(nil)
+		return c.run(ctx, cmd)
+	})
+}
+
+func (c *Client) vbmOut(ctx context.Context, args ...string) (string, error) {
+	var out string
+	err := c.retry(ctx, func() error {
+		var stdout bytes.Buffer
+		cmd := c.command(args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = c.tee(nil)
+		err := c.run(ctx, cmd)
+		out = stdout.String()
+		return err
+	})
+	return out, err
 }
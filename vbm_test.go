@@ -1,7 +1,18 @@
 package virtualbox
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -9,9 +20,148 @@ func init() {
 }
 
 func TestVBMOut(t *testing.T) {
-	b, err := vbmOut("list", "vms")
+	b, err := DefaultClient.vbmOut(context.Background(), "list", "vms")
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("%s", b)
 }
+
+// fakeVBM is an Executor that records commands and replays canned output
+// keyed by the space-joined arguments.
+type fakeVBM struct {
+	calls  [][]string
+	stdin  map[string][]byte
+	stdout map[string]string
+	stderr map[string]string
+	errs   map[string]error
+}
+
+func newFakeVBM() *fakeVBM {
+	return &fakeVBM{
+		stdin:  map[string][]byte{},
+		stdout: map[string]string{},
+		stderr: map[string]string{},
+		errs:   map[string]error{},
+	}
+}
+
+func (f *fakeVBM) Exec(ctx context.Context, cmd *Command) error {
+	f.calls = append(f.calls, cmd.Args)
+	key := strings.Join(cmd.Args, " ")
+	if cmd.Stdin != nil {
+		b, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		f.stdin[key] = b
+	}
+	if cmd.Stdout != nil {
+		io.WriteString(cmd.Stdout, f.stdout[key])
+	}
+	if cmd.Stderr != nil {
+		io.WriteString(cmd.Stderr, f.stderr[key])
+	}
+	return f.errs[key]
+}
+
+func (f *fakeVBM) client() *Client {
+	return &Client{Executor: f}
+}
+
+func TestClientRoutesThroughExecutor(t *testing.T) {
+	var got []string
+	exec := ExecFunc(func(ctx context.Context, cmd *Command) error {
+		got = append(got, cmd.Path+" "+strings.Join(cmd.Args, " "))
+		return nil
+	})
+	a := &Client{VBM: "/opt/vbox-a/VBoxManage", Executor: exec}
+	b := &Client{VBM: "/opt/vbox-b/VBoxManage", Executor: exec}
+	ctx := context.Background()
+	if err := a.SetExtra(ctx, "global", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DelExtra(ctx, "global", "k"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"/opt/vbox-a/VBoxManage setextradata global k v",
+		"/opt/vbox-b/VBoxManage setextradata global k",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestClientVersionCached(t *testing.T) {
+	var got []string
+	exec := ExecFunc(func(ctx context.Context, cmd *Command) error {
+		got = append(got, cmd.Path)
+		fmt.Fprintf(cmd.Stdout, "%s\n", strings.TrimPrefix(filepath.Dir(cmd.Path), "/opt/vbox-"))
+		return nil
+	})
+	c := &Client{VBM: "/opt/vbox-6.1.46/VBoxManage", Executor: exec}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if v, err := c.Version(ctx); err != nil || v != "6.1.46" {
+			t.Fatalf("got %q, %v", v, err)
+		}
+	}
+	c.VBM = "/opt/vbox-7.0.10/VBoxManage"
+	if v, err := c.Version(ctx); err != nil || v != "7.0.10" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	if len(got) != 2 {
+		t.Errorf("ran VBoxManage --version %d times, want 2", len(got))
+	}
+}
+
+func TestClientLogger(t *testing.T) {
+	var buf bytes.Buffer
+	c := &Client{
+		Verbose:  true,
+		Logger:   log.New(&buf, "", 0),
+		Executor: ExecFunc(func(context.Context, *Command) error { return nil }),
+	}
+	if err := c.vbm(context.Background(), "list", "vms"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "executing: VBoxManage list vms"; !strings.Contains(buf.String(), want) {
+		t.Fatalf("log %q does not contain %q", buf.String(), want)
+	}
+}
+
+func TestClientExecError(t *testing.T) {
+	errFail := errors.New("exit status 1")
+	c := &Client{Executor: ExecFunc(func(ctx context.Context, cmd *Command) error {
+		return fmt.Errorf("%w", errFail)
+	})}
+	if err := c.vbm(context.Background(), "list", "vms"); !errors.Is(err, errFail) {
+		t.Fatalf("got %v, want %v", err, errFail)
+	}
+	c.Executor = ExecFunc(func(ctx context.Context, cmd *Command) error {
+		return &exec.Error{Name: cmd.Path, Err: exec.ErrNotFound}
+	})
+	if err := c.vbm(context.Background(), "list", "vms"); err != ErrVBMNotFound {
+		t.Fatalf("got %v, want %v", err, ErrVBMNotFound)
+	}
+}
+
+func TestVBMContextDeadline(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	c := NewClient(sleep)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = c.vbm(ctx, "10")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("command was not killed, took %v", d)
+	}
+}
@@ -0,0 +1,263 @@
+// Package vdi reads and writes dynamic VirtualBox Disk Images without
+// VirtualBox.
+package vdi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	signature  = 0xbeda107f
+	version    = 0x00010001 // 1.1
+	headerSize = 400        // size of the 1.1 header
+	blockSize  = 1 << 20
+	dataAlign  = 1 << 20
+	sectorSize = 512
+
+	blockFree = 0xffffffff // unallocated block
+	blockZero = 0xfffffffe // block known to be zero
+)
+
+// Image types.
+const (
+	TypeDynamic = 1
+	TypeFixed   = 2
+	TypeUndo    = 3
+	TypeDiff    = 4
+)
+
+// preInfo is the text at the start of images made by VirtualBox.
+const preInfo = "<<< Oracle VM VirtualBox Disk Image >>>\n"
+
+// ErrNotVDI is returned when an image does not start with a VDI header.
+var ErrNotVDI = errors.New("vdi: not a VDI image")
+
+// UUID is a UUID as stored in VDI headers: the first three fields are
+// little-endian.
+type UUID [16]byte
+
+// IsZero reports whether u is the nil UUID.
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+func (u UUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(u[0:4]),
+		binary.LittleEndian.Uint16(u[4:6]),
+		binary.LittleEndian.Uint16(u[6:8]),
+		u[8:10], u[10:])
+}
+
+func newUUID() (UUID, error) {
+	var u UUID
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	u[7] = u[7]&0x0f | 0x40 // version 4, in the little-endian third field
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// Geometry is a disk geometry.
+type Geometry struct {
+	Cylinders  uint32
+	Heads      uint32
+	Sectors    uint32
+	SectorSize uint32
+}
+
+// Header is the header of a VDI image, following the pre-header.
+type Header struct {
+	PreInfo          [64]byte
+	Signature        uint32
+	Version          uint32
+	HeaderSize       uint32
+	Type             uint32
+	Flags            uint32
+	Description      [256]byte
+	OffBlocks        uint32 // offset of the block map
+	OffData          uint32 // offset of the first block
+	Legacy           Geometry
+	Dummy            uint32
+	DiskSize         uint64 // in bytes
+	BlockSize        uint32
+	BlockExtra       uint32
+	Blocks           uint32
+	Allocated        uint32
+	UUID             UUID
+	ModifyUUID       UUID
+	ParentUUID       UUID // zero unless the image is a differencing image
+	ParentModifyUUID UUID
+	LCHS             Geometry
+}
+
+// Reader reads the virtual disk contents of a VDI image.
+type Reader struct {
+	r      io.ReaderAt
+	Header Header
+	blocks []uint32
+}
+
+// NewReader returns a Reader for the VDI image r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	vr := &Reader{r: r}
+	h := &vr.Header
+	if err := binary.Read(io.NewSectionReader(r, 0, 512), binary.LittleEndian, h); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotVDI
+		}
+		return nil, err
+	}
+	if h.Signature != signature {
+		return nil, ErrNotVDI
+	}
+	if h.Version>>16 != 1 {
+		return nil, fmt.Errorf("vdi: unsupported version %d.%d", h.Version>>16, h.Version&0xffff)
+	}
+	if h.BlockSize == 0 || uint64(h.Blocks)*uint64(h.BlockSize) < h.DiskSize {
+		return nil, fmt.Errorf("vdi: invalid block geometry")
+	}
+	vr.blocks = make([]uint32, h.Blocks)
+	sr := io.NewSectionReader(r, int64(h.OffBlocks), int64(h.Blocks)*4)
+	if err := binary.Read(sr, binary.LittleEndian, vr.blocks); err != nil {
+		return nil, fmt.Errorf("vdi: block map: %w", err)
+	}
+	return vr, nil
+}
+
+// Size returns the size of the virtual disk in bytes.
+func (vr *Reader) Size() int64 {
+	return int64(vr.Header.DiskSize)
+}
+
+// Blocks returns the block map: for every block of the disk, the index of
+// the block in the image. Unallocated blocks are 0xffffffff, or 0xfffffffe
+// if they are known to be zero.
+func (vr *Reader) Blocks() []uint32 {
+	return vr.blocks
+}
+
+// ReadAt reads virtual disk contents. Unallocated blocks read as zeros.
+func (vr *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("vdi: negative offset")
+	}
+	size := vr.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > size-off {
+		p, err = p[:size-off], io.EOF
+	}
+	bs := int64(vr.Header.BlockSize)
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		b, in := pos/bs, pos%bs
+		chunk := p[n:]
+		if int64(len(chunk)) > bs-in {
+			chunk = chunk[:bs-in]
+		}
+		if idx := vr.blocks[b]; idx >= blockZero {
+			for i := range chunk {
+				chunk[i] = 0
+			}
+		} else {
+			at := int64(vr.Header.OffData) + int64(idx)*(bs+int64(vr.Header.BlockExtra)) + int64(vr.Header.BlockExtra) + in
+			if _, rerr := vr.r.ReadAt(chunk, at); rerr != nil {
+				return n, rerr
+			}
+		}
+		n += len(chunk)
+	}
+	return n, err
+}
+
+// WriteDynamic writes a dynamic VDI image of a disk of capacity bytes to w,
+// reading the raw disk contents from r. If r ends early, the rest of the disk
+// is zero. Blocks that are all zero are not allocated.
+//
+// Blocks are written as they are read; the header and block map are written
+// last. To write from an io.ReaderAt, pass an io.SectionReader.
+func WriteDynamic(w io.WriterAt, r io.Reader, capacity int64) error {
+	if capacity <= 0 || capacity%sectorSize != 0 {
+		return fmt.Errorf("vdi: invalid capacity %d: must be a positive multiple of %d", capacity, sectorSize)
+	}
+	blocks := uint32((capacity + blockSize - 1) / blockSize)
+	h := Header{
+		Signature:  signature,
+		Version:    version,
+		HeaderSize: headerSize,
+		Type:       TypeDynamic,
+		OffBlocks:  align(int64(64+8+headerSize), dataAlign),
+		Legacy:     Geometry{SectorSize: sectorSize},
+		DiskSize:   uint64(capacity),
+		BlockSize:  blockSize,
+		Blocks:     blocks,
+		LCHS:       Geometry{SectorSize: sectorSize},
+	}
+	copy(h.PreInfo[:], preInfo)
+	h.OffData = align(int64(h.OffBlocks)+int64(blocks)*4, dataAlign)
+	var err error
+	if h.UUID, err = newUUID(); err != nil {
+		return err
+	}
+	if h.ModifyUUID, err = newUUID(); err != nil {
+		return err
+	}
+
+	bmap := make([]uint32, blocks)
+	lr := io.LimitReader(r, capacity)
+	block := make([]byte, blockSize)
+	for b := range bmap {
+		n, err := io.ReadFull(lr, block)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		if zero(block) {
+			bmap[b] = blockFree
+			continue
+		}
+		if _, err := w.WriteAt(block, int64(h.OffData)+int64(h.Allocated)*blockSize); err != nil {
+			return err
+		}
+		bmap[b] = h.Allocated
+		h.Allocated++
+	}
+
+	var hb bytes.Buffer
+	if err := binary.Write(&hb, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	meta := make([]byte, h.OffData)
+	copy(meta, hb.Bytes())
+	for i, idx := range bmap {
+		binary.LittleEndian.PutUint32(meta[int(h.OffBlocks)+4*i:], idx)
+	}
+	_, err = w.WriteAt(meta, 0)
+	return err
+}
+
+func align(n, to int64) uint32 {
+	return uint32((n + to - 1) / to * to)
+}
+
+// zero reports whether b only holds zero bytes.
+func zero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
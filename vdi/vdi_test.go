@@ -0,0 +1,58 @@
+package vdi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDynamicRoundTrip(t *testing.T) {
+	const capacity = 5<<20 + 512
+	raw := make([]byte, capacity)
+	copy(raw, "boot sector")
+	copy(raw[3<<20:], "third block")
+	copy(raw[capacity-512:], "last sector")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.vdi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteDynamic(f, bytes.NewReader(raw), capacity); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := r.Header
+	if h.Type != TypeDynamic || h.Blocks != 6 || h.Allocated != 3 || h.UUID.IsZero() || !h.ParentUUID.IsZero() {
+		t.Errorf("header: got %+v", h)
+	}
+	want := []uint32{0, blockFree, blockFree, 1, blockFree, 2}
+	for i, b := range r.Blocks() {
+		if b != want[i] {
+			t.Errorf("block %d: got %#x, want %#x", i, b, want[i])
+		}
+	}
+	if fi, _ := f.Stat(); fi.Size() != int64(h.OffData)+3<<20 {
+		t.Errorf("image size: got %d", fi.Size())
+	}
+	got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Error("contents changed in round trip")
+	}
+}
+
+func TestNotVDI(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(make([]byte, 1024))); !errors.Is(err, ErrNotVDI) {
+		t.Errorf("got %v, want %v", err, ErrNotVDI)
+	}
+}
@@ -0,0 +1,86 @@
+package vmdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WriteMonolithicSparse writes a monolithicSparse VMDK image of a disk of
+// capacity bytes to w, reading the raw disk contents from r. If r ends early,
+// the rest of the disk is zero. Grains that are all zero are not allocated.
+//
+// Grains are written as they are read; the grain tables, which precede them
+// in the file, are written last. To write from an io.ReaderAt, pass an
+// io.SectionReader.
+func WriteMonolithicSparse(w io.WriterAt, r io.Reader, capacity int64) error {
+	if capacity <= 0 {
+		return fmt.Errorf("vmdk: invalid capacity %d", capacity)
+	}
+	capSectors := uint64(sectors(capacity))
+	desc := descriptor("monolithicSparse", capSectors)
+
+	grains := (capSectors + grainSectors - 1) / grainSectors
+	tables := (grains + gtEntries - 1) / gtEntries
+	gdSectors := uint64(sectors(int64(tables) * 4))
+	gtSectors := uint64(gtEntries * 4 / SectorSize)
+
+	// Layout: header, descriptor, redundant directory and tables, directory
+	// and tables, then the grains from the next grain boundary on.
+	h := newHeader(capSectors)
+	h.Version = 1
+	h.Flags = flagNewlineTest | flagRedundantGT
+	h.DescriptorSize = uint64(sectors(int64(len(desc))))
+	if h.DescriptorSize < 20 {
+		h.DescriptorSize = 20 // room to edit the descriptor in place
+	}
+	h.RGDOffset = 1 + h.DescriptorSize
+	h.GDOffset = h.RGDOffset + gdSectors + tables*gtSectors
+	h.OverHead = h.GDOffset + gdSectors + tables*gtSectors
+	h.OverHead = (h.OverHead + grainSectors - 1) / grainSectors * grainSectors
+
+	const grainBytes = grainSectors * SectorSize
+	gt := make([]uint32, tables*gtEntries)
+	next := h.OverHead // sector of the next allocated grain
+	lr := io.LimitReader(r, capacity)
+	grain := make([]byte, grainBytes)
+	for g := uint64(0); g < grains; g++ {
+		n, err := io.ReadFull(lr, grain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		for i := n; i < len(grain); i++ {
+			grain[i] = 0
+		}
+		if zero(grain) {
+			continue
+		}
+		if _, err := w.WriteAt(grain, int64(next)*SectorSize); err != nil {
+			return err
+		}
+		gt[g] = uint32(next)
+		next += grainSectors
+	}
+
+	var meta bytes.Buffer
+	if err := binary.Write(&meta, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	meta.WriteString(desc)
+	meta.Write(make([]byte, int(h.RGDOffset)*SectorSize-meta.Len()))
+	for _, gdOffset := range []uint64{h.RGDOffset, h.GDOffset} {
+		gd := make([]uint32, tables)
+		for i := range gd {
+			gd[i] = uint32(gdOffset + gdSectors + uint64(i)*gtSectors)
+		}
+		binary.Write(&meta, binary.LittleEndian, gd)
+		meta.Write(make([]byte, int(gdSectors)*SectorSize-len(gd)*4))
+		binary.Write(&meta, binary.LittleEndian, gt)
+	}
+	// The grains start at the overhead, so a disk without any data still
+	// has its full metadata area.
+	meta.Write(make([]byte, int(h.OverHead)*SectorSize-meta.Len()))
+	_, err := w.WriteAt(meta.Bytes(), 0)
+	return err
+}
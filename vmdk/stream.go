@@ -0,0 +1,160 @@
+package vmdk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WriteStreamOptimized writes a streamOptimized VMDK image of a disk of
+// capacity bytes to w, reading the raw disk contents from r. If r ends early,
+// the rest of the disk is zero. Grains that are all zero are not stored.
+func WriteStreamOptimized(w io.Writer, r io.Reader, capacity int64) error {
+	if capacity <= 0 {
+		return fmt.Errorf("vmdk: invalid capacity %d", capacity)
+	}
+	capSectors := uint64(sectors(capacity))
+	desc := descriptor("streamOptimized", capSectors)
+
+	h := newHeader(capSectors)
+	h.Version = 3
+	h.Flags = flagNewlineTest | flagCompressed | flagMarkers
+	h.DescriptorSize = uint64(sectors(int64(len(desc))))
+	h.GDOffset = gdAtEnd
+	h.OverHead = 1 + h.DescriptorSize
+	h.CompressAlgorithm = compressDeflate
+
+	sw := &sectorWriter{w: bufio.NewWriterSize(w, 1<<20)}
+	if err := sw.write(h); err != nil {
+		return err
+	}
+	if err := sw.write([]byte(desc)); err != nil {
+		return err
+	}
+
+	const grainBytes = grainSectors * SectorSize
+	grains := (capSectors + grainSectors - 1) / grainSectors
+	gd := make([]uint32, (grains+gtEntries-1)/gtEntries)
+	gt := make([]uint32, gtEntries)
+	used := false // whether gt has entries
+	lr := io.LimitReader(r, capacity)
+	grain := make([]byte, grainBytes)
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+
+	for g := uint64(0); g < grains; g++ {
+		n, err := io.ReadFull(lr, grain)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		for i := n; i < len(grain); i++ {
+			grain[i] = 0
+		}
+		if !zero(grain) {
+			zbuf.Reset()
+			zw.Reset(&zbuf)
+			if _, err := zw.Write(grain); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			gt[g%gtEntries] = uint32(sw.sector())
+			used = true
+			var marker [12]byte
+			binary.LittleEndian.PutUint64(marker[:], g*grainSectors)
+			binary.LittleEndian.PutUint32(marker[8:], uint32(zbuf.Len()))
+			if err := sw.write(append(marker[:], zbuf.Bytes()...)); err != nil {
+				return err
+			}
+		}
+		if g%gtEntries == gtEntries-1 || g == grains-1 {
+			if used {
+				if err := sw.marker(4*gtEntries/SectorSize, markerGrainTable); err != nil {
+					return err
+				}
+				gd[g/gtEntries] = uint32(sw.sector())
+				if err := sw.write(gt); err != nil {
+					return err
+				}
+			}
+			for i := range gt {
+				gt[i] = 0
+			}
+			used = false
+		}
+	}
+
+	if err := sw.marker(uint64(sectors(int64(len(gd))*4)), markerGrainDir); err != nil {
+		return err
+	}
+	h.GDOffset = uint64(sw.sector())
+	if err := sw.write(gd); err != nil {
+		return err
+	}
+	if err := sw.marker(1, markerFooter); err != nil {
+		return err
+	}
+	if err := sw.write(h); err != nil {
+		return err
+	}
+	if err := sw.marker(0, markerEOS); err != nil {
+		return err
+	}
+	return sw.w.Flush()
+}
+
+// zero reports whether b only holds zero bytes.
+func zero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sectorWriter writes data padded to whole sectors and tracks the offset.
+type sectorWriter struct {
+	w *bufio.Writer
+	n int64 // bytes written
+}
+
+// sector returns the current sector.
+func (sw *sectorWriter) sector() int64 {
+	return sw.n / SectorSize
+}
+
+// write writes data, which is a byte slice or fixed-size value, and pads it
+// to the next sector boundary.
+func (sw *sectorWriter) write(data interface{}) error {
+	var err error
+	if b, ok := data.([]byte); ok {
+		_, err = sw.w.Write(b)
+		sw.n += int64(len(b))
+	} else {
+		err = binary.Write(sw.w, binary.LittleEndian, data)
+		sw.n += int64(binary.Size(data))
+	}
+	if err != nil {
+		return err
+	}
+	if pad := (SectorSize - sw.n%SectorSize) % SectorSize; pad > 0 {
+		if _, err := sw.w.Write(make([]byte, pad)); err != nil {
+			return err
+		}
+		sw.n += pad
+	}
+	return nil
+}
+
+// marker writes a metadata marker announcing n sectors of the given type.
+func (sw *sectorWriter) marker(n uint64, typ uint32) error {
+	var m [16]byte
+	binary.LittleEndian.PutUint64(m[:], n)
+	binary.LittleEndian.PutUint32(m[12:], typ)
+	return sw.write(m[:])
+}
@@ -0,0 +1,293 @@
+// Package vmdk reads and writes sparse VMDK disk images without VirtualBox.
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// SectorSize is the size of a VMDK sector in bytes.
+const SectorSize = 512
+
+const (
+	magic        = 0x564d444b // "KDMV"
+	grainSectors = 128        // 64 KiB grains
+	gtEntries    = 512        // grain table entries per grain table
+	gdAtEnd      = ^uint64(0) // the grain directory follows the grains
+
+	flagNewlineTest  = 1 << 0
+	flagRedundantGT  = 1 << 1
+	flagCompressed   = 1 << 16
+	flagMarkers      = 1 << 17
+	compressDeflate  = 1
+	markerEOS        = 0
+	markerGrainTable = 1
+	markerGrainDir   = 2
+	markerFooter     = 3
+)
+
+// ErrNotVMDK is returned when an image does not start with a sparse extent
+// header.
+var ErrNotVMDK = errors.New("vmdk: not a sparse VMDK image")
+
+// header is the sparse extent header at the start of the image (and, for
+// streamOptimized images, in the footer).
+type header struct {
+	Magic              uint32
+	Version            uint32
+	Flags              uint32
+	Capacity           uint64 // in sectors
+	GrainSize          uint64 // in sectors
+	DescriptorOffset   uint64 // in sectors
+	DescriptorSize     uint64 // in sectors
+	NumGTEsPerGT       uint32
+	RGDOffset          uint64 // in sectors
+	GDOffset           uint64 // in sectors
+	OverHead           uint64 // in sectors
+	UncleanShutdown    uint8
+	SingleEndLineChar  byte
+	NonEndLineChar     byte
+	DoubleEndLineChar1 byte
+	DoubleEndLineChar2 byte
+	CompressAlgorithm  uint16
+	Pad                [433]byte
+}
+
+func newHeader(capacity uint64) header {
+	return header{
+		Magic:              magic,
+		Capacity:           capacity,
+		GrainSize:          grainSectors,
+		DescriptorOffset:   1,
+		NumGTEsPerGT:       gtEntries,
+		SingleEndLineChar:  '\n',
+		NonEndLineChar:     ' ',
+		DoubleEndLineChar1: '\r',
+		DoubleEndLineChar2: '\n',
+	}
+}
+
+// descriptor returns an embedded descriptor for a monolithic image of the
+// given type and capacity in sectors.
+func descriptor(createType string, capacity uint64) string {
+	cylinders := capacity / (16 * 63)
+	if cylinders > 16383 {
+		cylinders = 16383
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Disk DescriptorFile\n")
+	fmt.Fprintf(&b, "version=1\n")
+	fmt.Fprintf(&b, "CID=%08x\n", rand.Uint32())
+	fmt.Fprintf(&b, "parentCID=ffffffff\n")
+	fmt.Fprintf(&b, "createType=%q\n\n", createType)
+	fmt.Fprintf(&b, "# Extent description\n")
+	fmt.Fprintf(&b, "RW %d SPARSE \"disk.vmdk\"\n\n", capacity)
+	fmt.Fprintf(&b, "# The Disk Data Base\n#DDB\n\n")
+	fmt.Fprintf(&b, "ddb.virtualHWVersion = \"4\"\n")
+	fmt.Fprintf(&b, "ddb.adapterType = \"ide\"\n")
+	fmt.Fprintf(&b, "ddb.geometry.cylinders = \"%d\"\n", cylinders)
+	fmt.Fprintf(&b, "ddb.geometry.heads = \"16\"\n")
+	fmt.Fprintf(&b, "ddb.geometry.sectors = \"63\"\n")
+	return b.String()
+}
+
+// sectors returns the number of sectors needed for n bytes.
+func sectors(n int64) int64 {
+	return (n + SectorSize - 1) / SectorSize
+}
+
+// Reader reads the virtual disk contents of a monolithicSparse or
+// streamOptimized VMDK image.
+type Reader struct {
+	r    io.ReaderAt
+	h    header
+	desc string
+	gd   []uint32
+
+	// mu guards the caches, so that ReadAt can be called in parallel.
+	mu       sync.Mutex
+	gts      map[uint32][]uint32 // grain tables by sector
+	grain    []byte              // last decompressed grain
+	grainPos int64               // its sector, or 0
+}
+
+// NewReader returns a Reader for the image r of the given file size.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	vr := &Reader{r: r, gts: map[uint32][]uint32{}}
+	if err := vr.readHeader(0, &vr.h); err != nil {
+		return nil, err
+	}
+	if vr.h.GDOffset == gdAtEnd {
+		// The footer is the second to last sector, followed by the
+		// end-of-stream marker.
+		if size < 3*SectorSize {
+			return nil, fmt.Errorf("vmdk: image too short for a footer")
+		}
+		if err := vr.readHeader(size-2*SectorSize, &vr.h); err != nil {
+			return nil, fmt.Errorf("vmdk: footer: %w", err)
+		}
+	}
+	if vr.h.GrainSize == 0 || vr.h.NumGTEsPerGT == 0 {
+		return nil, fmt.Errorf("vmdk: invalid grain geometry")
+	}
+
+	if vr.h.DescriptorSize > 0 {
+		desc := make([]byte, vr.h.DescriptorSize*SectorSize)
+		if _, err := r.ReadAt(desc, int64(vr.h.DescriptorOffset)*SectorSize); err != nil {
+			return nil, fmt.Errorf("vmdk: descriptor: %w", err)
+		}
+		vr.desc = string(bytes.TrimRight(desc, "\x00"))
+	}
+
+	grains := (vr.h.Capacity + vr.h.GrainSize - 1) / vr.h.GrainSize
+	tables := (grains + uint64(vr.h.NumGTEsPerGT) - 1) / uint64(vr.h.NumGTEsPerGT)
+	vr.gd = make([]uint32, tables)
+	sr := io.NewSectionReader(r, int64(vr.h.GDOffset)*SectorSize, int64(tables)*4)
+	if err := binary.Read(sr, binary.LittleEndian, vr.gd); err != nil {
+		return nil, fmt.Errorf("vmdk: grain directory: %w", err)
+	}
+	return vr, nil
+}
+
+func (vr *Reader) readHeader(off int64, h *header) error {
+	if err := binary.Read(io.NewSectionReader(vr.r, off, SectorSize), binary.LittleEndian, h); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrNotVMDK
+		}
+		return err
+	}
+	if h.Magic != magic {
+		return ErrNotVMDK
+	}
+	return nil
+}
+
+// Size returns the size of the virtual disk in bytes.
+func (vr *Reader) Size() int64 {
+	return int64(vr.h.Capacity) * SectorSize
+}
+
+// StreamOptimized reports whether the image has compressed grains.
+func (vr *Reader) StreamOptimized() bool {
+	return vr.h.Flags&flagCompressed != 0
+}
+
+// Descriptor returns the embedded descriptor.
+func (vr *Reader) Descriptor() string {
+	return vr.desc
+}
+
+// ReadAt reads virtual disk contents. Unallocated grains read as zeros.
+func (vr *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("vmdk: negative offset")
+	}
+	size := vr.Size()
+	if off >= size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > size-off {
+		p, err = p[:size-off], io.EOF
+	}
+	grainBytes := int64(vr.h.GrainSize) * SectorSize
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		g, in := pos/grainBytes, pos%grainBytes
+		chunk := p[n:]
+		if int64(len(chunk)) > grainBytes-in {
+			chunk = chunk[:grainBytes-in]
+		}
+		if rerr := vr.readGrain(chunk, uint64(g), in); rerr != nil {
+			return n, rerr
+		}
+		n += len(chunk)
+	}
+	return n, err
+}
+
+// readGrain fills p from offset in of grain g.
+func (vr *Reader) readGrain(p []byte, g uint64, in int64) error {
+	entry, err := vr.grainEntry(g)
+	if err != nil {
+		return err
+	}
+	if entry <= 1 { // unallocated or zeroed
+		for i := range p {
+			p[i] = 0
+		}
+		return nil
+	}
+	if !vr.StreamOptimized() {
+		_, err := vr.r.ReadAt(p, int64(entry)*SectorSize+in)
+		return err
+	}
+	vr.mu.Lock()
+	grain := vr.grain
+	if vr.grainPos != int64(entry) {
+		grain = nil
+	}
+	vr.mu.Unlock()
+	if grain == nil {
+		if grain, err = vr.inflate(int64(entry)); err != nil {
+			return err
+		}
+		vr.mu.Lock()
+		vr.grain, vr.grainPos = grain, int64(entry)
+		vr.mu.Unlock()
+	}
+	copy(p, grain[in:])
+	return nil
+}
+
+// grainEntry returns the grain table entry of grain g.
+func (vr *Reader) grainEntry(g uint64) (uint32, error) {
+	per := uint64(vr.h.NumGTEsPerGT)
+	gtSector := vr.gd[g/per]
+	if gtSector == 0 {
+		return 0, nil
+	}
+	vr.mu.Lock()
+	gt, ok := vr.gts[gtSector]
+	vr.mu.Unlock()
+	if !ok {
+		gt = make([]uint32, per)
+		sr := io.NewSectionReader(vr.r, int64(gtSector)*SectorSize, int64(per)*4)
+		if err := binary.Read(sr, binary.LittleEndian, gt); err != nil {
+			return 0, fmt.Errorf("vmdk: grain table at sector %d: %w", gtSector, err)
+		}
+		vr.mu.Lock()
+		vr.gts[gtSector] = gt
+		vr.mu.Unlock()
+	}
+	return gt[g%per], nil
+}
+
+// inflate decompresses the grain whose marker is at the given sector into a
+// new buffer. Grains are never modified once returned, so they can be shared
+// through the cache.
+func (vr *Reader) inflate(sector int64) ([]byte, error) {
+	var marker [12]byte
+	if _, err := vr.r.ReadAt(marker[:], sector*SectorSize); err != nil {
+		return nil, fmt.Errorf("vmdk: grain marker at sector %d: %w", sector, err)
+	}
+	size := binary.LittleEndian.Uint32(marker[8:])
+	zr, err := zlib.NewReader(io.NewSectionReader(vr.r, sector*SectorSize+12, int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("vmdk: grain at sector %d: %w", sector, err)
+	}
+	defer zr.Close()
+	grain := make([]byte, vr.h.GrainSize*SectorSize)
+	if _, err := io.ReadFull(zr, grain); err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("vmdk: grain at sector %d: %w", sector, err)
+	}
+	return grain, nil
+}
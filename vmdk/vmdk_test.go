@@ -0,0 +1,149 @@
+package vmdk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStreamOptimizedRoundTrip(t *testing.T) {
+	// Three grain tables worth of disk, with data in the first and last
+	// grain only, and a capacity that is not a whole number of grains.
+	const capacity = 2*gtEntries*grainSectors*SectorSize + 3*SectorSize
+	raw := make([]byte, capacity)
+	copy(raw, "boot sector")
+	copy(raw[capacity-SectorSize:], "last sector")
+
+	var img bytes.Buffer
+	if err := WriteStreamOptimized(&img, bytes.NewReader(raw), capacity); err != nil {
+		t.Fatal(err)
+	}
+	if img.Len()%SectorSize != 0 {
+		t.Errorf("image size %d is not a multiple of the sector size", img.Len())
+	}
+	if img.Len() > 64<<10 {
+		t.Errorf("image of %d bytes stored zero grains", img.Len())
+	}
+
+	r, err := NewReader(bytes.NewReader(img.Bytes()), int64(img.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.StreamOptimized() || r.Size() != capacity {
+		t.Errorf("got stream=%v size=%d", r.StreamOptimized(), r.Size())
+	}
+	if !bytes.Contains([]byte(r.Descriptor()), []byte(`createType="streamOptimized"`)) {
+		t.Errorf("descriptor: %q", r.Descriptor())
+	}
+	got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Error("contents changed in round trip")
+	}
+}
+
+func TestStreamOptimizedParallelReadAt(t *testing.T) {
+	const grainBytes = grainSectors * SectorSize
+	const capacity = (gtEntries + 64) * grainBytes // two grain tables
+	raw := make([]byte, capacity)
+	for g := 0; g < capacity/grainBytes; g += 17 {
+		copy(raw[g*grainBytes:], fmt.Sprintf("grain %d", g))
+	}
+	var img bytes.Buffer
+	if err := WriteStreamOptimized(&img, bytes.NewReader(raw), capacity); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(img.Bytes()), int64(img.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := make([]byte, SectorSize)
+			for g := i; g < capacity/grainBytes; g += 8 {
+				off := int64(g-g%17) * grainBytes
+				if _, err := r.ReadAt(buf, off); err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(buf, raw[off:off+SectorSize]) {
+					t.Errorf("grain at %d: got %q", off, buf[:16])
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStreamOptimizedShortReader(t *testing.T) {
+	var img bytes.Buffer
+	if err := WriteStreamOptimized(&img, bytes.NewReader([]byte("abc")), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(img.Bytes()), int64(img.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 4)
+	if _, err := r.ReadAt(p, 0); err != nil || string(p) != "abc\x00" {
+		t.Errorf("got %q, %v", p, err)
+	}
+}
+
+func TestNotVMDK(t *testing.T) {
+	raw := make([]byte, 4096)
+	if _, err := NewReader(bytes.NewReader(raw), int64(len(raw))); !errors.Is(err, ErrNotVMDK) {
+		t.Errorf("got %v, want %v", err, ErrNotVMDK)
+	}
+}
+
+func TestMonolithicSparseRoundTrip(t *testing.T) {
+	const capacity = gtEntries*grainSectors*SectorSize + 7*SectorSize
+	raw := make([]byte, capacity)
+	copy(raw[grainSectors*SectorSize:], "second grain")
+	copy(raw[capacity-SectorSize:], "last sector")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "disk.vmdk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteMonolithicSparse(f, io.NewSectionReader(bytes.NewReader(raw), 0, capacity), capacity); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > 1<<20 {
+		t.Errorf("image of %d bytes allocated zero grains", fi.Size())
+	}
+
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.StreamOptimized() || !strings.Contains(r.Descriptor(), `createType="monolithicSparse"`) {
+		t.Errorf("descriptor: %q", r.Descriptor())
+	}
+	got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Error("contents changed in round trip")
+	}
+}
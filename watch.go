@@ -0,0 +1,73 @@
+package virtualbox
+
+import (
+	"context"
+	"time"
+)
+
+// StateChange reports that a watched machine changed its state.
+type StateChange struct {
+	ID   string       // Name or UUID the machine is watched by.
+	From MachineState // Empty for the first observation.
+	To   MachineState
+	Time time.Time // When the change was observed.
+	Err  error     // Set instead of To if the machine could not be polled.
+}
+
+// WatchMachines polls the machines with the given names or UUIDs at the
+// client's PollInterval and sends every state change on the returned channel.
+// The first observation of each machine is sent with an empty From. The
+// channel is closed once ctx is done.
+func WatchMachines(ctx context.Context, ids ...string) <-chan StateChange {
+	return DefaultClient.WatchMachines(ctx, ids...)
+}
+
+// WatchMachines polls the machines with the given names or UUIDs at the
+// client's PollInterval and sends every state change on the returned channel.
+// The first observation of each machine is sent with an empty From. The
+// channel is closed once ctx is done.
+func (c *Client) WatchMachines(ctx context.Context, ids ...string) <-chan StateChange {
+	ch := make(chan StateChange)
+	go func() {
+		defer close(ch)
+		tick := time.NewTicker(c.pollInterval())
+		defer tick.Stop()
+		last := make(map[string]MachineState, len(ids))
+		failed := make(map[string]bool, len(ids))
+		for {
+			for _, id := range ids {
+				ev := StateChange{ID: id, From: last[id]}
+				m, err := c.getMachine(ctx, id)
+				if ctx.Err() != nil {
+					return
+				}
+				switch {
+				case err != nil:
+					if failed[id] {
+						continue // report each failure streak once
+					}
+					failed[id] = true
+					ev.Err = err
+				case m.state == ev.From && !failed[id]:
+					continue
+				default:
+					failed[id] = false
+					last[id] = m.state
+					ev.To = m.state
+				}
+				ev.Time = time.Now()
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,76 @@
+package virtualbox
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stateSequence returns a client whose showvminfo reports the given states
+// in turn, repeating the last one.
+func stateSequence(states ...MachineState) *Client {
+	var mu sync.Mutex
+	return &Client{
+		PollInterval: time.Millisecond,
+		Executor: ExecFunc(func(ctx context.Context, cmd *Command) error {
+			if cmd.Args[0] != "showvminfo" {
+				return nil
+			}
+			mu.Lock()
+			s := states[0]
+			if len(states) > 1 {
+				states = states[1:]
+			}
+			mu.Unlock()
+			io.WriteString(cmd.Stdout, "name=\"dev\"\nVMState=\""+string(s)+"\"\n")
+			return nil
+		}),
+	}
+}
+
+func TestWaitForState(t *testing.T) {
+	c := stateSequence(Poweroff, Poweroff, Running)
+	m := &machine{client: c, name: "dev"}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.WaitForState(ctx, Running, Aborted); err != nil {
+		t.Fatal(err)
+	}
+	if m.State() != Running {
+		t.Fatalf("state = %s, want running", m.State())
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.WaitForState(ctx, Saved); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("got %v, want deadline exceeded", err)
+	}
+}
+
+func TestWatchMachines(t *testing.T) {
+	c := stateSequence(Poweroff, Running, Running, Aborted)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got []StateChange
+	for ev := range c.WatchMachines(ctx, "dev") {
+		if ev.Err != nil {
+			t.Fatal(ev.Err)
+		}
+		got = append(got, ev)
+		if ev.To == Aborted {
+			cancel()
+		}
+	}
+	want := []struct{ from, to MachineState }{{"", Poweroff}, {Poweroff, Running}, {Running, Aborted}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i, w := range want {
+		if got[i].ID != "dev" || got[i].From != w.from || got[i].To != w.to {
+			t.Errorf("event %d = %+v, want %s -> %s", i, got[i], w.from, w.to)
+		}
+	}
+}